@@ -0,0 +1,39 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AltService is an alternative way of reaching the server, advertised to
+// clients with the Alt-Svc header (RFC 7838).
+type AltService struct {
+	// Protocol is the ALPN protocol ID, e.g. "h3".
+	Protocol string
+	// Authority is where the service is, e.g. ":443" for the same host on
+	// port 443 or "alt.example.com:8443".
+	Authority string
+	// MaxAge is how long clients may remember the service for. When zero the
+	// ma parameter is left out and clients fall back to 24 hours.
+	MaxAge time.Duration
+}
+
+// String formats the service as an Alt-Svc list entry.
+func (as AltService) String() string {
+	s := fmt.Sprintf("%s=%q", as.Protocol, as.Authority)
+	if as.MaxAge > 0 {
+		s += fmt.Sprintf("; ma=%d", int64(as.MaxAge/time.Second))
+	}
+	return s
+}
+
+// formatAltSvc builds an Alt-Svc header value, or "" if there are no
+// services.
+func formatAltSvc(services []AltService) string {
+	entries := make([]string, len(services))
+	for i, as := range services {
+		entries[i] = as.String()
+	}
+	return strings.Join(entries, ", ")
+}
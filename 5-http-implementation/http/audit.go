@@ -0,0 +1,49 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// AuditFunc receives a copy of a request body once the request has been
+// handled. truncated is set when the body was longer than the audit limit.
+type AuditFunc func(req *Request, body []byte, truncated bool)
+
+// AuditBody wraps a Handler so that up to limit bytes of each request body are
+// copied aside as the handler reads them and then passed to audit. The handler
+// still reads the body as a stream so large uploads are not held in memory.
+func AuditBody(h Handler, limit int64, audit AuditFunc) Handler {
+	return HandlerFunc(func(res *Response, req *Request) {
+		cw := &cappedWriter{limit: limit}
+		body := io.TeeReader(req.Body, cw)
+		req.Body = body
+
+		h.ServeHTTP(res, req)
+
+		// The handler may not have read the whole body, so read what is left up
+		// to the limit (plus one byte to find out whether it was truncated).
+		io.Copy(ioutil.Discard, io.LimitReader(body, limit-int64(cw.buf.Len())+1))
+
+		audit(req, cw.buf.Bytes(), cw.truncated)
+	})
+}
+
+// cappedWriter keeps the first limit bytes written to it and discards the rest.
+type cappedWriter struct {
+	limit     int64
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// Write always reports success so that it never interrupts the reader it is
+// teed from.
+func (cw *cappedWriter) Write(b []byte) (int, error) {
+	if room := cw.limit - int64(cw.buf.Len()); int64(len(b)) > room {
+		cw.buf.Write(b[:room])
+		cw.truncated = true
+		return len(b), nil
+	}
+
+	return cw.buf.Write(b)
+}
@@ -0,0 +1,45 @@
+package http_test
+
+import (
+	"bytes"
+	"io"
+	stdhttp "net/http"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestAuditBody(t *testing.T) {
+	const reqBody = "hello world"
+
+	var (
+		handled   []byte
+		audited   []byte
+		truncated bool
+	)
+	audit := func(req *http.Request, body []byte, trunc bool) {
+		audited, truncated = body, trunc
+	}
+	h := http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		// Only read part of the body to check that auditing reads the rest.
+		handled = make([]byte, 3)
+		io.ReadFull(req.Body, handled)
+	})
+	url := startServer(t, http.AuditBody(h, 5, audit))
+
+	resp, err := stdhttp.Post(url, "text/plain", bytes.NewReader([]byte(reqBody)))
+	if err != nil {
+		t.Fatal("post failed:", err)
+	}
+	resp.Body.Close()
+
+	if exp := "hel"; string(handled) != exp {
+		t.Fatalf("expected handler to read '%s', got: '%s'", exp, handled)
+	}
+	if exp := "hello"; string(audited) != exp {
+		t.Fatalf("expected audited body '%s', got: '%s'", exp, audited)
+	}
+	if !truncated {
+		t.Fatal("expected audited body to be marked truncated")
+	}
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// breakerState is the position of a Breaker's circuit.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// Breaker is a circuit breaker that wraps a Handler which depends on an
+// upstream service. Responses with a 5xx status count as failures. Once the
+// failure rate within a Window crosses Threshold the circuit opens and requests
+// fail fast with 503 until Cooldown has passed, at which point a single probe
+// request is let through to decide whether to close the circuit again.
+type Breaker struct {
+	Handler Handler
+
+	// Threshold is the fraction of failed requests (0 to 1) that opens the
+	// circuit. The circuit never opens without at least one failure, so a
+	// zero Threshold opens it on the first.
+	Threshold float64
+	// MinRequests is the number of requests that must be seen within a Window
+	// before Threshold is considered. If zero, every request is considered.
+	MinRequests int
+	// Window is how long failures are counted for before the counts reset.
+	Window time.Duration
+	// Cooldown is how long the circuit stays open before probing.
+	Cooldown time.Duration
+
+	mu          sync.Mutex
+	state       breakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (b *Breaker) ServeHTTP(res *Response, req *Request) {
+	ok, probe, retry := b.allow()
+	if !ok {
+		res.Headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		res.WriteError(503, "upstream circuit is open")
+		return
+	}
+
+	// A handler that panics counts as a failure, and must not leave a probe
+	// unfinished.
+	succeeded := false
+	defer func() { b.record(probe, succeeded) }()
+
+	b.Handler.ServeHTTP(res, req)
+	succeeded = res.Status < 500
+}
+
+// allow reports whether a request may reach the wrapped Handler, and whether
+// it is the probe. If not, it also returns how long until the circuit will
+// next be probed.
+func (b *Breaker) allow() (ok, probe bool, retry time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if wait := b.Cooldown - time.Since(b.openedAt); wait > 0 {
+			return false, false, wait
+		}
+		// Let this request through as the probe.
+		b.state = breakerHalfOpen
+		return true, true, 0
+	case breakerHalfOpen:
+		// A probe is already in flight.
+		return false, false, b.Cooldown
+	}
+
+	return true, false, 0
+}
+
+// record updates the circuit with the outcome of a request. probe is whether
+// the request was let through as the probe.
+func (b *Breaker) record(probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	if probe {
+		if ok {
+			b.state = breakerClosed
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		} else {
+			b.state, b.openedAt = breakerOpen, now
+		}
+		return
+	}
+	if b.state != breakerClosed {
+		// The request was let through before the circuit opened, so it says
+		// nothing about whether the upstream has recovered.
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+
+	b.requests++
+	if !ok {
+		b.failures++
+	}
+
+	if b.failures > 0 && b.requests >= b.MinRequests && float64(b.failures)/float64(b.requests) >= b.Threshold {
+		b.state, b.openedAt = breakerOpen, now
+	}
+}
@@ -0,0 +1,146 @@
+package http_test
+
+import (
+	stdhttp "net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestBreaker(t *testing.T) {
+	var (
+		calls  int32
+		status int32 = 502
+	)
+	url := startServer(t, &http.Breaker{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			res.Status = int(atomic.LoadInt32(&status))
+		}),
+		Threshold:   0.5,
+		MinRequests: 2,
+		Window:      time.Minute,
+		Cooldown:    100 * time.Millisecond,
+	})
+
+	get := func() int {
+		resp, err := stdhttp.Get(url)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Two failures should open the circuit.
+	for i := 0; i < 2; i++ {
+		if code := get(); code != 502 {
+			t.Fatalf("expected status code 502, got: %v", code)
+		}
+	}
+	if code := get(); code != 503 {
+		t.Fatalf("expected open circuit to respond 503, got: %v", code)
+	}
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Fatalf("expected handler to be called 2 times, got: %v", c)
+	}
+
+	// After the cooldown a successful probe should close the circuit.
+	atomic.StoreInt32(&status, 200)
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code := get(); code != 200 {
+			t.Fatalf("expected status code 200, got: %v", code)
+		}
+	}
+}
+
+func TestBreakerZeroThreshold(t *testing.T) {
+	var status int32 = 200
+	url := startServer(t, &http.Breaker{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			res.Status = int(atomic.LoadInt32(&status))
+		}),
+		Window:   time.Minute,
+		Cooldown: time.Minute,
+	})
+
+	get := func() int {
+		resp, err := stdhttp.Get(url)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Successful traffic should never open the circuit.
+	for i := 0; i < 5; i++ {
+		if code := get(); code != 200 {
+			t.Fatalf("expected status code 200, got: %v", code)
+		}
+	}
+
+	atomic.StoreInt32(&status, 500)
+	if code := get(); code != 500 {
+		t.Fatalf("expected status code 500, got: %v", code)
+	}
+	if code := get(); code != 503 {
+		t.Fatalf("expected first failure to open the circuit, got: %v", code)
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	release := make(chan struct{})
+	b := &http.Breaker{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			switch req.URI {
+			case "/panic":
+				panic("upstream client failed")
+			case "/fail":
+				res.Status = 502
+			case "/slow":
+				<-release
+			}
+		}),
+		Threshold:   0.5,
+		MinRequests: 1,
+		Window:      time.Minute,
+		Cooldown:    50 * time.Millisecond,
+	}
+	serve := func(uri string) int {
+		res := &http.Response{Status: 200, Headers: http.Header{}}
+		b.ServeHTTP(res, &http.Request{Method: "GET", URI: uri, Headers: http.Header{}})
+		return res.Status
+	}
+
+	// A request let through while the circuit was closed finishes after it
+	// has opened, and must not be taken as the outcome of the probe.
+	slow := make(chan int)
+	go func() { slow <- serve("/slow") }()
+	time.Sleep(20 * time.Millisecond)
+	if code := serve("/fail"); code != 502 {
+		t.Fatalf("expected status code 502, got: %v", code)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// The probe panics, which should count as a failure.
+	func() {
+		defer func() { recover() }()
+		serve("/panic")
+	}()
+	close(release)
+	<-slow
+	if code := serve("/"); code != 503 {
+		t.Fatalf("expected circuit to be open after a panicking probe, got: %v", code)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code := serve("/"); code != 200 {
+			t.Fatalf("expected a healthy probe to close the circuit, got: %v", code)
+		}
+	}
+}
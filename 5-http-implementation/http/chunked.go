@@ -0,0 +1,272 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// streamThreshold is how much of a response body is buffered before the
+// response switches to streaming.
+const streamThreshold = 32 << 10
+
+// maxChunkLine caps the length of a chunk size line, and maxTrailerBytes the
+// trailers of a chunked body when the Server has no MaxConnBytes.
+const (
+	maxChunkLine    = 4 << 10
+	maxTrailerBytes = 64 << 10
+)
+
+// errResponseFailed is returned when writing to a streamed response whose
+// headers could not be sent.
+var errResponseFailed = errors.New("response headers could not be sent")
+
+// Flush sends the status line and headers, if they have not been sent yet,
+// followed by the body buffered so far. After the first Flush the status and
+// headers can no longer be changed and later Writes are sent as they are
+// flushed.
+//
+// Unless the handler has set a Content-Length header the body is sent with
+// chunked transfer encoding, or for HTTP/1.0 clients, which do not understand
+// chunks, by closing the connection once it is complete.
+//
+// Flush does nothing for responses that can only be buffered. It fails without
+// sending anything if the status is not one this package supports.
+func (res *Response) Flush() error {
+	if res.w == nil {
+		return nil
+	}
+	if res.failed {
+		return errResponseFailed
+	}
+
+	if !res.streaming {
+		// Check the status before committing to streaming, as once streaming
+		// the body has to go out without a status line ahead of it.
+		if _, ok := statusTitles[res.Status]; !ok {
+			return fmt.Errorf("unsupported status code: %v", res.Status)
+		}
+
+		res.streaming = true
+		if _, ok := res.Headers["Content-Length"]; !ok {
+			if res.proto == http11 {
+				res.chunked = true
+				res.Headers.Set("Transfer-Encoding", "chunked")
+			} else {
+				res.closeAfter = true
+				res.Headers.Set("Connection", "close")
+			}
+		}
+
+		if err := res.writeHeadersTo(res.w); err != nil {
+			res.failed = true
+			return err
+		}
+	}
+
+	if res.buf.Len() == 0 {
+		return nil
+	}
+	_, err := res.writeBody(res.buf.Bytes())
+	res.buf.Reset()
+	return err
+}
+
+// bufferLimit is how many body bytes may be buffered before the response
+// either has to be streamed or, if it cannot be, has overflowed.
+func (res *Response) bufferLimit() int {
+	limit := res.limit
+	if res.w != nil && (limit == 0 || limit > streamThreshold) {
+		limit = streamThreshold
+	}
+	if limit == 0 {
+		return math.MaxInt32
+	}
+	return limit
+}
+
+// writeBody sends part of a streamed body, framing it as a chunk if need be.
+func (res *Response) writeBody(b []byte) (int, error) {
+	if res.head {
+		return len(b), nil
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if !res.chunked {
+		return res.w.Write(b)
+	}
+	return writeChunk(res.w, b)
+}
+
+// writeChunk writes b to w as a single chunk. An empty b would mark the end of
+// the body, so it is ignored.
+func writeChunk(w io.Writer, b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if _, err := fmt.Fprintf(w, "%x\r\n", len(b)); err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	_, err = io.WriteString(w, "\r\n")
+	return n, err
+}
+
+// finish sends whatever is left of a streamed body and marks its end.
+func (res *Response) finish() error {
+	if err := res.Flush(); err != nil {
+		return err
+	}
+	if res.chunked && !res.head {
+		_, err := io.WriteString(res.w, "0\r\n\r\n")
+		return err
+	}
+	return nil
+}
+
+// errChunkedEncoding is returned when a chunked body is malformed.
+var errChunkedEncoding = errors.New("malformed chunked encoding")
+
+// errChunkLineTooLong is returned when a chunk size line or the trailers of a
+// chunked body are too long.
+var errChunkLineTooLong = errors.New("chunked encoding line too long")
+
+// chunkedReader decodes a request body sent with chunked transfer encoding.
+// Chunk extensions and trailers are read and discarded.
+type chunkedReader struct {
+	buf *bufio.Reader
+
+	// trailerLimit caps the combined length of the trailers, or is zero for
+	// maxTrailerBytes.
+	trailerLimit int
+
+	// left is the number of bytes left in the current chunk.
+	left int64
+	// done is set once the last chunk and trailers have been read.
+	done bool
+	err  error
+}
+
+// Read satisfies the io.Reader interface.
+func (cr *chunkedReader) Read(b []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	if cr.done {
+		return 0, io.EOF
+	}
+
+	if cr.left == 0 {
+		if cr.err = cr.nextChunk(); cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.done {
+			return 0, io.EOF
+		}
+	}
+
+	if int64(len(b)) > cr.left {
+		b = b[:cr.left]
+	}
+	n, err := cr.buf.Read(b)
+	cr.left -= int64(n)
+
+	// Each chunk is followed by a crlf.
+	if cr.left == 0 && err == nil {
+		err = cr.expectCRLF()
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	cr.err = err
+	return n, err
+}
+
+// nextChunk reads the size line of the next chunk, along with the trailers if
+// it is the last one.
+func (cr *chunkedReader) nextChunk() error {
+	ln, err := cr.readLine(maxChunkLine)
+	if err != nil {
+		return err
+	}
+
+	// Drop any chunk extensions, e.g. "1a;name=value".
+	if i := strings.IndexByte(ln, ';'); i >= 0 {
+		ln = ln[:i]
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(ln), 16, 64)
+	if err != nil || size < 0 {
+		return errChunkedEncoding
+	}
+
+	if size > 0 {
+		cr.left = size
+		return nil
+	}
+
+	// The last chunk is followed by optional trailers and an empty line.
+	left := cr.trailerLimit
+	if left == 0 {
+		left = maxTrailerBytes
+	}
+	for {
+		ln, err := cr.readLine(left)
+		if err != nil {
+			return err
+		}
+		left -= len(ln) + 2
+		if ln == "" {
+			cr.done = true
+			return nil
+		}
+	}
+}
+
+// expectCRLF consumes the crlf that ends a chunk's data.
+func (cr *chunkedReader) expectCRLF() error {
+	ln, err := cr.readLine(2)
+	if err == errChunkLineTooLong {
+		return errChunkedEncoding
+	}
+	if err != nil {
+		return err
+	}
+	if ln != "" {
+		return errChunkedEncoding
+	}
+	return nil
+}
+
+// readLine reads a line of chunk framing and strips off the trailing crlf.
+// Lines longer than max, including the crlf, are rejected rather than
+// buffered.
+func (cr *chunkedReader) readLine(max int) (string, error) {
+	var ln []byte
+	for {
+		b, err := cr.buf.ReadSlice('\n')
+		if len(ln)+len(b) > max {
+			return "", errChunkLineTooLong
+		}
+		ln = append(ln, b...)
+
+		switch err {
+		case nil:
+			return strings.TrimSuffix(string(ln), "\r\n"), nil
+		case bufio.ErrBufferFull:
+			// Keep reading the rest of the line.
+		case io.EOF:
+			return "", io.ErrUnexpectedEOF
+		default:
+			return "", err
+		}
+	}
+}
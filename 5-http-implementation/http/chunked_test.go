@@ -0,0 +1,213 @@
+package http_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestChunkedRequest(t *testing.T) {
+	var body []byte
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			res.Status = 400
+		}
+	}))
+	addr := strings.TrimPrefix(url, "http://")
+
+	cases := []struct {
+		name   string
+		req    string
+		status int
+		body   string
+	}{
+		{
+			name:   "chunked",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n6\r\n world\r\n0\r\nX-Trailer: t\r\n\r\n",
+			status: 200,
+			body:   "hello world",
+		},
+		{
+			name:   "malformed chunk size",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "chunk size line too long",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;" + strings.Repeat("x", 8<<10) + "\r\nhello\r\n0\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "trailers too long",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n" + strings.Repeat("X-Trailer: t\r\n", 8<<10) + "\r\n",
+			status: 400,
+		},
+		{
+			name:   "content-length and transfer-encoding",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "unsupported transfer-encoding",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			status: 400,
+		},
+	}
+
+	for _, c := range cases {
+		body = nil
+
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, resp.StatusCode)
+		}
+		if c.body != "" && string(body) != c.body {
+			t.Fatalf("%s: expected body '%s', got: '%s'", c.name, c.body, body)
+		}
+	}
+}
+
+func TestStreamedResponse(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 100<<10)
+
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		switch req.URI {
+		case "/flush":
+			res.Write([]byte("first "))
+			res.Flush()
+			res.Write([]byte("second"))
+		case "/large":
+			res.Write(large)
+		case "/length":
+			res.Headers.Set("Content-Length", "5")
+			res.Flush()
+			res.Write([]byte("fixed"))
+		}
+	}))
+
+	cases := []struct {
+		path    string
+		chunked bool
+		body    []byte
+	}{
+		{path: "/flush", chunked: true, body: []byte("first second")},
+		{path: "/large", chunked: true, body: large},
+		{path: "/length", chunked: false, body: []byte("fixed")},
+	}
+
+	for _, c := range cases {
+		resp, err := stdhttp.Get(url + c.path)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: unable to read body: %v", c.path, err)
+		}
+
+		if chunked := len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked"; chunked != c.chunked {
+			t.Fatalf("%s: expected chunked %v, got: %v", c.path, c.chunked, chunked)
+		}
+		if !bytes.Equal(body, c.body) {
+			t.Fatalf("%s: expected %v body bytes, got: %v", c.path, len(c.body), len(body))
+		}
+	}
+}
+
+func TestStreamedResponseHTTP10(t *testing.T) {
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Write([]byte("streamed"))
+		res.Flush()
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		t.Fatal("unable to write request:", err)
+	}
+	resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal("unable to read body:", err)
+	}
+
+	if len(resp.TransferEncoding) != 0 {
+		t.Fatalf("expected no transfer-encoding for HTTP/1.0, got: %v", resp.TransferEncoding)
+	}
+	if string(body) != "streamed" {
+		t.Fatalf("expected body 'streamed', got: '%s'", body)
+	}
+}
+
+func TestStreamedResponseStatus(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 80<<10)
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		if req.URI == "/unsupported" {
+			res.Status = 299
+		} else {
+			res.Status = 302
+			res.Headers.Set("Location", "/elsewhere")
+		}
+		res.Write(large)
+	}))
+	addr := strings.TrimPrefix(url, "http://")
+
+	// A status without a title cannot be sent, so nothing at all should be,
+	// rather than chunks without a status line.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET /unsupported HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal("unable to write request:", err)
+	}
+	if raw, _ := ioutil.ReadAll(conn); len(raw) != 0 {
+		t.Fatalf("expected connection to be closed without a response, got %v bytes", len(raw))
+	}
+
+	client := &stdhttp.Client{CheckRedirect: func(*stdhttp.Request, []*stdhttp.Request) error {
+		return stdhttp.ErrUseLastResponse
+	}}
+	resp, err := client.Get(url + "/found")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal("unable to read body:", err)
+	}
+	if resp.StatusCode != 302 || !bytes.Equal(body, large) {
+		t.Fatalf("expected streamed 302 with %v bytes, got: %v with %v bytes", len(large), resp.StatusCode, len(body))
+	}
+}
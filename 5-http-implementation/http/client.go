@@ -0,0 +1,449 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxIdlePerHost is the number of idle connections a Client keeps open
+// to each host unless told otherwise.
+const DefaultMaxIdlePerHost = 2
+
+// ErrNoHost is returned by Client.Do for a request without a host header.
+var ErrNoHost = errors.New("request has no host header")
+
+// Client sends HTTP requests and reads their responses. Connections are kept
+// open after a response has been read, if the server allows it, and reused for
+// later requests to the same host.
+//
+// A Client is safe for concurrent use; its zero value is ready to use.
+type Client struct {
+	// Dial opens a connection to addr. If nil, net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+
+	// MaxIdlePerHost caps the idle connections kept open to each host. If
+	// zero, DefaultMaxIdlePerHost is used; if negative, connections are never
+	// reused.
+	MaxIdlePerHost int
+
+	mu   sync.Mutex
+	idle map[string][]*clientConn
+}
+
+// clientConn is a connection opened by a Client.
+type clientConn struct {
+	netConn net.Conn
+	buf     *bufio.Reader
+	addr    string
+}
+
+// Get sends a GET request for rawurl.
+func (c *Client) Get(rawurl string) (*Response, error) {
+	req, err := newClientRequest("GET", rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Post sends a POST request for rawurl with the given content type and body.
+func (c *Client) Post(rawurl, contentType string, body io.Reader) (*Response, error) {
+	req, err := newClientRequest("POST", rawurl)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers.Set("Content-Type", contentType)
+	req.Body = body
+	return c.Do(req)
+}
+
+// newClientRequest creates a Request for a http URL.
+func newClientRequest(method, rawurl string) (*Request, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported url scheme: %q", u.Scheme)
+	}
+
+	return &Request{
+		Method:  method,
+		URI:     u.RequestURI(),
+		Proto:   http11,
+		Headers: Header{"Host": {u.Host}},
+	}, nil
+}
+
+// Do sends a request and reads the response status and headers. The server is
+// the one named by the request's host header, on port 80 unless it says
+// otherwise. A body without a content-length header is sent chunked.
+//
+// The caller must close the response Body, after which the connection is
+// kept for reuse if the body was read to the end. The server may have closed
+// a reused connection while it was idle, so a request that fails on one
+// before any of the response arrives is retried once on a new connection, as
+// long as it has no body and its method is safe to repeat (GET, HEAD, OPTIONS
+// or TRACE). Informational (1xx) responses are skipped over.
+func (c *Client) Do(req *Request) (*Response, error) {
+	host := req.Headers.Get("Host")
+	if host == "" {
+		return nil, ErrNoHost
+	}
+	addr := host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// An IPv6 address without a port is still bracketed.
+		addr = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), "80")
+	}
+
+	if cc := c.getIdle(addr); cc != nil {
+		res, unanswered, err := c.roundTrip(cc, req)
+		if err == nil || !unanswered || !retryable(req) {
+			return res, err
+		}
+	}
+
+	cc, err := c.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	res, _, err := c.roundTrip(cc, req)
+	return res, err
+}
+
+// retryable reports whether req can be sent again without risk of the server
+// acting on it twice.
+func retryable(req *Request) bool {
+	if req.Body != nil {
+		return false
+	}
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// roundTrip sends req on cc and reads the response to it. cc is closed if
+// anything goes wrong. unanswered reports whether it went wrong before any of
+// the response was read.
+func (c *Client) roundTrip(cc *clientConn, req *Request) (res *Response, unanswered bool, err error) {
+	if err := cc.writeRequest(req); err != nil {
+		cc.netConn.Close()
+		return nil, true, err
+	}
+	if _, err := cc.buf.Peek(1); err != nil {
+		cc.netConn.Close()
+		return nil, true, err
+	}
+
+	res, reuse, err := cc.readResponse(req)
+	if err != nil {
+		cc.netConn.Close()
+		return nil, false, err
+	}
+	if strings.ToLower(req.Headers.Get("Connection")) == "close" {
+		reuse = false
+	}
+
+	body := &clientBody{r: res.Body, cc: cc, client: c, reuse: reuse}
+	if res.Body == nil {
+		// There is nothing to read, so the connection is free straight away.
+		body.r = strings.NewReader("")
+		body.release()
+		body.err = io.EOF
+	}
+	res.Body = body
+
+	return res, false, nil
+}
+
+// dial opens a new connection to addr.
+func (c *Client) dial(addr string) (*clientConn, error) {
+	dial := c.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	nc, err := dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientConn{
+		netConn: nc,
+		buf:     bufio.NewReader(nc),
+		addr:    addr,
+	}, nil
+}
+
+// getIdle takes an idle connection to addr out of the pool, if there is one.
+func (c *Client) getIdle(addr string) *clientConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conns := c.idle[addr]
+	if len(conns) == 0 {
+		return nil
+	}
+	cc := conns[len(conns)-1]
+	c.idle[addr] = conns[:len(conns)-1]
+	return cc
+}
+
+// putIdle returns a connection to the pool, or closes it if the pool for its
+// host is full.
+func (c *Client) putIdle(cc *clientConn) {
+	max := c.MaxIdlePerHost
+	if max == 0 {
+		max = DefaultMaxIdlePerHost
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle[cc.addr]) >= max {
+		cc.netConn.Close()
+		return
+	}
+	if c.idle == nil {
+		c.idle = make(map[string][]*clientConn)
+	}
+	c.idle[cc.addr] = append(c.idle[cc.addr], cc)
+}
+
+// CloseIdle closes every idle connection. Connections in use are unaffected.
+func (c *Client) CloseIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, conns := range c.idle {
+		for _, cc := range conns {
+			cc.netConn.Close()
+		}
+	}
+	c.idle = nil
+}
+
+// writeRequest sends the request line, headers and body.
+func (cc *clientConn) writeRequest(req *Request) error {
+	method, uri, proto := req.Method, req.URI, req.Proto
+	if method == "" {
+		method = "GET"
+	}
+	if uri == "" {
+		uri = "/"
+	}
+	if proto == "" {
+		proto = http11
+	}
+
+	headers := req.Headers
+	_, hasLength := headers["Content-Length"]
+	chunked := req.Body != nil && !hasLength
+	if chunked {
+		headers = headers.clone()
+		headers.Set("Transfer-Encoding", "chunked")
+	}
+
+	w := bufio.NewWriter(cc.netConn)
+	fmt.Fprintf(w, "%s %s %s\r\n", method, uri, proto)
+	headers.writeTo(w)
+	io.WriteString(w, "\r\n")
+
+	switch {
+	case chunked:
+		b := make([]byte, 32<<10)
+		for {
+			n, err := req.Body.Read(b)
+			if _, werr := writeChunk(w, b[:n]); werr != nil {
+				return werr
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		io.WriteString(w, "0\r\n\r\n")
+	case req.Body != nil:
+		if _, err := io.Copy(w, req.Body); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// readResponse reads the status line and headers of the response to req and
+// sets up its Body, which is left nil if the response has none. reuse reports
+// whether the connection may be used again once the body has been read.
+func (cc *clientConn) readResponse(req *Request) (res *Response, reuse bool, err error) {
+	// Informational responses, such as 100 Continue or 103 Early Hints, come
+	// ahead of the real one and have no body. 101 Switching Protocols is the
+	// exception, as nothing that follows it is HTTP.
+	for {
+		if res, err = cc.readHead(); err != nil {
+			return nil, false, err
+		}
+		if res.Status >= 200 || res.Status == 101 {
+			break
+		}
+	}
+	proto, status := res.proto, res.Status
+
+	conn := strings.ToLower(res.Headers.Get("Connection"))
+	if proto == http10 {
+		reuse = conn == "keep-alive"
+	} else {
+		reuse = conn != "close"
+	}
+
+	switch {
+	case status == 101:
+		// The connection no longer speaks HTTP, so it must not be pooled.
+		return res, false, nil
+	case req.Method == "HEAD" || status == 204 || status == 304 || status < 200:
+		return res, reuse, nil
+	case strings.ToLower(res.Headers.Get("Transfer-Encoding")) == "chunked":
+		res.Body = ioutil.NopCloser(&chunkedReader{buf: cc.buf})
+	case res.Headers.Get("Content-Length") != "":
+		n, err := strconv.ParseInt(res.Headers.Get("Content-Length"), 10, 64)
+		if err != nil || n < 0 {
+			return nil, false, fmt.Errorf("invalid content-length: %q", res.Headers.Get("Content-Length"))
+		}
+		if n == 0 {
+			return res, reuse, nil
+		}
+		res.Body = ioutil.NopCloser(&io.LimitedReader{R: cc.buf, N: n})
+	default:
+		// The body runs until the server closes the connection.
+		res.Body = ioutil.NopCloser(cc.buf)
+		reuse = false
+	}
+
+	return res, reuse, nil
+}
+
+// readHead reads the status line and headers of a response.
+func (cc *clientConn) readHead() (*Response, error) {
+	ln, err := readFramingLine(cc.buf)
+	if err != nil {
+		return nil, err
+	}
+	proto, status, ok := parseStatusLine(ln)
+	if !ok {
+		return nil, fmt.Errorf("malformed status line: %q", ln)
+	}
+
+	res := &Response{
+		Status:  status,
+		Headers: make(Header),
+		proto:   proto,
+	}
+	for {
+		ln, err := readFramingLine(cc.buf)
+		if err != nil {
+			return nil, err
+		}
+		if ln == "" {
+			return res, nil
+		}
+
+		key, val, ok := parseHeaderLine(ln)
+		if !ok {
+			return nil, fmt.Errorf("malformed header line: %q", ln)
+		}
+		res.Headers.Add(key, val)
+	}
+}
+
+// readFramingLine reads a line from buf and strips off its line ending.
+func readFramingLine(buf *bufio.Reader) (string, error) {
+	ln, err := buf.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(ln, "\r\n"), nil
+}
+
+// parseStatusLine parses the first line of a response, e.g. "HTTP/1.1 200 OK".
+func parseStatusLine(ln string) (proto string, status int, ok bool) {
+	s := strings.SplitN(ln, " ", 3)
+	if len(s) < 2 || !strings.HasPrefix(s[0], "HTTP/1.") {
+		return
+	}
+
+	status, err := strconv.Atoi(s[1])
+	if err != nil || len(s[1]) != 3 {
+		return
+	}
+
+	return s[0], status, true
+}
+
+// errBodyClosed is returned when reading a response body after closing it.
+var errBodyClosed = errors.New("read on closed response body")
+
+// clientBody is the Body of a response read by a Client. The connection goes
+// back to the pool once the body has been read to the end; closing the body
+// before then closes the connection.
+type clientBody struct {
+	r      io.Reader
+	cc     *clientConn
+	client *Client
+	reuse  bool
+
+	// done is set once the connection has been released, and err is what
+	// later Reads return.
+	done bool
+	err  error
+}
+
+// Read satisfies the io.Reader interface.
+func (b *clientBody) Read(p []byte) (int, error) {
+	if b.done {
+		return 0, b.err
+	}
+
+	n, err := b.r.Read(p)
+	if err != nil {
+		if err != io.EOF {
+			b.reuse = false
+		}
+		b.release()
+		b.err = err
+	}
+	return n, err
+}
+
+// Close satisfies the io.Closer interface.
+func (b *clientBody) Close() error {
+	if !b.done {
+		// Whatever is left of the body would be in the way of the next
+		// response.
+		b.reuse = false
+		b.release()
+	}
+	b.err = errBodyClosed
+	return nil
+}
+
+// release hands the connection back to the pool, or closes it.
+func (b *clientBody) release() {
+	b.done = true
+	if b.reuse && b.client.MaxIdlePerHost >= 0 {
+		b.client.putIdle(b.cc)
+		return
+	}
+	b.cc.netConn.Close()
+}
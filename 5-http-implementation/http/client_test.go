@@ -0,0 +1,317 @@
+package http_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestClient(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 100<<10)
+
+	var dials int32
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		switch req.URI {
+		case "/echo":
+			body, _ := ioutil.ReadAll(req.Body)
+			res.Headers.Set("Content-Type", req.Headers.Get("Content-Type"))
+			res.Write(body)
+		case "/large":
+			res.Write(large)
+		case "/empty":
+			res.Status = 204
+		default:
+			res.Write([]byte("hello"))
+		}
+	}))
+	client := &http.Client{
+		Dial: func(network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return net.Dial(network, addr)
+		},
+	}
+
+	read := func(res *http.Response, err error) string {
+		if err != nil {
+			t.Fatal("request failed:", err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal("unable to read body:", err)
+		}
+		return string(body)
+	}
+
+	for i := 0; i < 3; i++ {
+		if body := read(client.Get(url + "/")); body != "hello" {
+			t.Fatalf("expected body 'hello', got: '%s'", body)
+		}
+	}
+
+	res, err := client.Post(url+"/echo", "text/plain", strings.NewReader("ping"))
+	if body := read(res, err); body != "ping" {
+		t.Fatalf("expected echoed body 'ping', got: '%s'", body)
+	}
+	if ct := res.Headers.Get("Content-Type"); ct != "text/plain" {
+		t.Fatalf("expected content type 'text/plain', got: '%s'", ct)
+	}
+
+	if body := read(client.Get(url + "/large")); body != string(large) {
+		t.Fatalf("expected %v body bytes, got: %v", len(large), len(body))
+	}
+
+	res, err = client.Get(url + "/empty")
+	if body := read(res, err); res.Status != 204 || body != "" {
+		t.Fatalf("expected empty 204, got: %v '%s'", res.Status, body)
+	}
+
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("expected requests to share 1 connection, got: %v", n)
+	}
+}
+
+func TestClientUnreadBody(t *testing.T) {
+	var dials int32
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Write([]byte("unread"))
+	}))
+	client := &http.Client{
+		Dial: func(network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return net.Dial(network, addr)
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		res.Body.Close()
+	}
+
+	// A body closed before it was read leaves the connection unusable.
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("expected 2 connections, got: %v", n)
+	}
+}
+
+func TestClientStaleConn(t *testing.T) {
+	var dials int32
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Write([]byte("ok"))
+	}))
+	client := &http.Client{
+		Dial: func(network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			conn, err := net.Dial(network, addr)
+			if atomic.LoadInt32(&dials) == 1 && err == nil {
+				// Simulate the server closing the pooled connection.
+				return &closeAfterRead{Conn: conn}, nil
+			}
+			return conn, err
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(url)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("expected stale connection to be replaced, got %v dials", n)
+	}
+}
+
+// closeAfterRead is a connection that fails every write after its first read.
+type closeAfterRead struct {
+	net.Conn
+	read int32
+}
+
+func (c *closeAfterRead) Read(b []byte) (int, error) {
+	atomic.StoreInt32(&c.read, 1)
+	return c.Conn.Read(b)
+}
+
+func (c *closeAfterRead) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.read) == 1 {
+		return 0, net.ErrClosed
+	}
+	return c.Conn.Write(b)
+}
+
+// rawServer answers each request with whatever respond writes to the
+// connection, closing the connection if respond returns false.
+func rawServer(t *testing.T, respond func(conn net.Conn, req *stdhttp.Request) bool) string {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := bufio.NewReader(conn)
+				for {
+					req, err := stdhttp.ReadRequest(buf)
+					if err != nil {
+						return
+					}
+					ioutil.ReadAll(req.Body)
+					if !respond(conn, req) {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return "http://" + l.Addr().String()
+}
+
+func TestClientRetry(t *testing.T) {
+	var requests sync.Map
+	url := rawServer(t, func(conn net.Conn, req *stdhttp.Request) bool {
+		n, _ := requests.LoadOrStore(req.Method+req.URL.Path, new(int32))
+		// Drop the connection after acting on the request, as a server that
+		// closes an idle connection at the wrong moment would.
+		if strings.HasPrefix(req.URL.Path, "/drop") && atomic.AddInt32(n.(*int32), 1) == 1 {
+			return false
+		}
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		return true
+	})
+	count := func(key string) int32 {
+		n, ok := requests.Load(key)
+		if !ok {
+			return 0
+		}
+		return atomic.LoadInt32(n.(*int32))
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		fails  bool
+		sent   int32
+	}{
+		{method: "GET", path: "/drop-get", sent: 2},
+		{method: "POST", path: "/drop-post", fails: true, sent: 1},
+		{method: "DELETE", path: "/drop-delete", fails: true, sent: 1},
+	}
+
+	for _, c := range cases {
+		client := &http.Client{}
+		// Leave a connection in the pool for the request to reuse.
+		res, err := client.Get(url + "/")
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		req := &http.Request{
+			Method:  c.method,
+			URI:     c.path,
+			Headers: http.Header{"Host": {strings.TrimPrefix(url, "http://")}},
+		}
+		res, err = client.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		if fails := err != nil; fails != c.fails {
+			t.Fatalf("%s %s: expected failure %v, got: %v", c.method, c.path, c.fails, err)
+		}
+		if n := count(c.method + c.path); n != c.sent {
+			t.Fatalf("%s %s: expected request to be sent %v times, got: %v", c.method, c.path, c.sent, n)
+		}
+	}
+}
+
+func TestClientInformational(t *testing.T) {
+	url := rawServer(t, func(conn net.Conn, req *stdhttp.Request) bool {
+		io.WriteString(conn, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\n")
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		return true
+	})
+
+	client := &http.Client{}
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(url + "/")
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.Status != 200 || string(body) != "ok" {
+			t.Fatalf("expected final 200 'ok', got: %v '%s'", res.Status, body)
+		}
+	}
+}
+
+func TestClientSwitchingProtocols(t *testing.T) {
+	var dials int32
+	url := rawServer(t, func(conn net.Conn, req *stdhttp.Request) bool {
+		if req.URL.Path == "/upgrade" {
+			io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: upgrade\r\nUpgrade: websocket\r\n\r\n")
+		} else {
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		}
+		return true
+	})
+	client := &http.Client{
+		Dial: func(network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return net.Dial(network, addr)
+		},
+	}
+
+	for _, path := range []string{"/upgrade", "/"} {
+		res, err := client.Get(url + path)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+
+	// The upgraded connection must not be used for the next request.
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Fatalf("expected 2 connections, got: %v", n)
+	}
+}
+
+func TestClientIPv6Host(t *testing.T) {
+	dialed := make(chan string, 1)
+	client := &http.Client{
+		Dial: func(network, addr string) (net.Conn, error) {
+			dialed <- addr
+			return nil, net.ErrClosed
+		},
+	}
+
+	client.Get("http://[::1]/")
+	if addr, exp := <-dialed, "[::1]:80"; addr != exp {
+		t.Fatalf("expected to dial %v, got: %v", exp, addr)
+	}
+}
@@ -0,0 +1,145 @@
+package http
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCookie is returned when a cookie value fails verification or
+// decryption.
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// CookieCodec protects cookie values before they are sent to a client and
+// checks them when they come back. The cookie name is bound into the result so
+// that a value cannot be moved from one cookie to another.
+type CookieCodec interface {
+	Encode(name, value string) (string, error)
+	Decode(name, encoded string) (string, error)
+}
+
+// cookieEncoding keeps encoded values within the characters allowed in a
+// cookie.
+var cookieEncoding = base64.RawURLEncoding
+
+// SignedCookie is a CookieCodec that appends an HMAC-SHA256 signature to the
+// value. Clients can read the value but not change it.
+//
+// The first key signs new values and all keys are tried when decoding, so keys
+// can be rotated by prepending a new one and dropping the oldest later.
+type SignedCookie struct {
+	Keys [][]byte
+}
+
+// Encode satisfies the CookieCodec interface.
+func (sc SignedCookie) Encode(name, value string) (string, error) {
+	if len(sc.Keys) == 0 {
+		return "", errors.New("signed cookie: no keys")
+	}
+
+	v := cookieEncoding.EncodeToString([]byte(value))
+	return v + "." + cookieEncoding.EncodeToString(sc.sign(sc.Keys[0], name, v)), nil
+}
+
+// Decode satisfies the CookieCodec interface.
+func (sc SignedCookie) Decode(name, encoded string) (string, error) {
+	i := strings.LastIndexByte(encoded, '.')
+	if i < 0 {
+		return "", ErrInvalidCookie
+	}
+	v := encoded[:i]
+	sig, err := cookieEncoding.DecodeString(encoded[i+1:])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, key := range sc.Keys {
+		if hmac.Equal(sig, sc.sign(key, name, v)) {
+			value, err := cookieEncoding.DecodeString(v)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+
+	return "", ErrInvalidCookie
+}
+
+// sign computes the signature of an encoded value for the named cookie.
+func (sc SignedCookie) sign(key []byte, name, v string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + v))
+	return mac.Sum(nil)
+}
+
+// EncryptedCookie is a CookieCodec that seals values with AES-GCM. Clients can
+// neither read nor change the value. Keys must be 16, 24 or 32 bytes long to
+// select AES-128, AES-192 or AES-256.
+//
+// As with SignedCookie, the first key encrypts new values and all keys are
+// tried when decoding.
+type EncryptedCookie struct {
+	Keys [][]byte
+}
+
+// Encode satisfies the CookieCodec interface.
+func (ec EncryptedCookie) Encode(name, value string) (string, error) {
+	if len(ec.Keys) == 0 {
+		return "", errors.New("encrypted cookie: no keys")
+	}
+
+	aead, err := newCookieAEAD(ec.Keys[0])
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return cookieEncoding.EncodeToString(sealed), nil
+}
+
+// Decode satisfies the CookieCodec interface.
+func (ec EncryptedCookie) Decode(name, encoded string) (string, error) {
+	sealed, err := cookieEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, key := range ec.Keys {
+		aead, err := newCookieAEAD(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return "", ErrInvalidCookie
+		}
+
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+
+	return "", ErrInvalidCookie
+}
+
+// newCookieAEAD creates an AES-GCM cipher from a key.
+func newCookieAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted cookie: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,52 @@
+package http_test
+
+import (
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestCookieCodecs(t *testing.T) {
+	var (
+		oldKey = []byte("0123456789abcdef")
+		newKey = []byte("fedcba9876543210")
+	)
+
+	codecs := map[string]func(keys ...[]byte) http.CookieCodec{
+		"signed":    func(keys ...[]byte) http.CookieCodec { return http.SignedCookie{Keys: keys} },
+		"encrypted": func(keys ...[]byte) http.CookieCodec { return http.EncryptedCookie{Keys: keys} },
+	}
+
+	for name, codec := range codecs {
+		enc, err := codec(oldKey).Encode("session", "user=42")
+		if err != nil {
+			t.Fatalf("%s: unable to encode: %v", name, err)
+		}
+
+		// Values encoded with an old key should still decode after rotation.
+		dec, err := codec(newKey, oldKey).Decode("session", enc)
+		if err != nil {
+			t.Fatalf("%s: unable to decode: %v", name, err)
+		}
+		if exp := "user=42"; dec != exp {
+			t.Fatalf("%s: expected '%s', got: '%s'", name, exp, dec)
+		}
+
+		// But not once the old key has been dropped.
+		if _, err := codec(newKey).Decode("session", enc); err != http.ErrInvalidCookie {
+			t.Fatalf("%s: expected ErrInvalidCookie after rotation, got: %v", name, err)
+		}
+
+		// Values must not be transferable between cookies.
+		if _, err := codec(oldKey).Decode("other", enc); err != http.ErrInvalidCookie {
+			t.Fatalf("%s: expected ErrInvalidCookie for other cookie, got: %v", name, err)
+		}
+
+		// Nor tampered with.
+		i := len(enc) / 2
+		tampered := enc[:i] + string(enc[i]^1) + enc[i+1:]
+		if _, err := codec(oldKey).Decode("session", tampered); err != http.ErrInvalidCookie {
+			t.Fatalf("%s: expected ErrInvalidCookie for tampered value, got: %v", name, err)
+		}
+	}
+}
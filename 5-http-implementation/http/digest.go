@@ -0,0 +1,156 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// digestAlgorithms are the Content-Digest algorithms (RFC 9530) that are
+// supported, in order of preference.
+var digestAlgorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+}
+
+// ContentDigest is middleware for the Content-Digest header (RFC 9530). It
+// verifies the digests of incoming request bodies, rejecting mismatches with
+// 400, and adds a digest of the response body when the client asks for one
+// with Want-Content-Digest.
+type ContentDigest struct {
+	Handler Handler
+
+	// Require rejects requests that have a body but no Content-Digest.
+	Require bool
+	// Always adds a sha-256 digest to every response, whether or not the client
+	// asked for one.
+	Always bool
+	// MaxBodyBytes caps the request body read to check its digest. Larger
+	// bodies are rejected with 413. If zero, DefaultMaxBodyBytes is used.
+	MaxBodyBytes int64
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (cd *ContentDigest) ServeHTTP(res *Response, req *Request) {
+	if status, msg := cd.verify(req); status != 0 {
+		res.WriteError(status, msg)
+		return
+	}
+
+	alg := cd.responseAlgorithm(req)
+	if alg == "" {
+		cd.Handler.ServeHTTP(res, req)
+		return
+	}
+
+	// The digest covers the whole body, so the body has to be held back until
+	// the handler is done.
+	captured := captureResponse(res)
+	cd.Handler.ServeHTTP(captured, req)
+	captured.Headers.Set("Content-Digest", alg+"=:"+digest(alg, captured.buf.Bytes())+":")
+	copyResponse(res, captured)
+}
+
+// verify checks the request body against its Content-Digest, returning the
+// status and a description of the problem if there is one. The body is read
+// in full and replaced so that the handler can still read it.
+func (cd *ContentDigest) verify(req *Request) (int, string) {
+	values, ok := req.Headers["Content-Digest"]
+	if !ok {
+		if cd.Require && hasBody(req) {
+			return 400, "content-digest is required"
+		}
+		return 0, ""
+	}
+
+	// A dictionary split over several lines is the same as one joined by
+	// commas.
+	digests, err := parseByteDictionary(strings.Join(values, ", "))
+	if err != nil {
+		return 400, err.Error()
+	}
+
+	body, err := readBody(req.Body, cd.MaxBodyBytes)
+	if err == errBodyTooLarge {
+		return 413, "request body is too large to check its content-digest"
+	}
+	if err != nil {
+		return 400, "unable to read body"
+	}
+	req.Body = bytes.NewReader(body)
+
+	checked := false
+	for _, alg := range digestAlgorithms {
+		sum, ok := digests[alg.name]
+		if !ok {
+			continue
+		}
+		if digest(alg.name, body) != base64.StdEncoding.EncodeToString(sum) {
+			return 400, alg.name + " content-digest does not match"
+		}
+		checked = true
+	}
+	if !checked {
+		return 400, "no supported content-digest algorithm"
+	}
+
+	return 0, ""
+}
+
+// responseAlgorithm picks the digest algorithm for the response, or "" if
+// none is wanted. Want-Content-Digest weights preferences from 1 to 10, with 0
+// meaning "not acceptable".
+func (cd *ContentDigest) responseAlgorithm(req *Request) string {
+	var (
+		best   string
+		weight int
+	)
+	for _, member := range strings.Split(strings.Join(req.Headers.Values("Want-Content-Digest"), ","), ",") {
+		kv := strings.SplitN(strings.TrimSpace(member), "=", 2)
+		if len(kv) != 2 || digestHash(kv[0]) == nil {
+			continue
+		}
+		if w, err := strconv.Atoi(kv[1]); err == nil && w > weight {
+			best, weight = kv[0], w
+		}
+	}
+
+	if best == "" && cd.Always {
+		return "sha-256"
+	}
+	return best
+}
+
+// digest returns the base64 encoded digest of b using the named algorithm.
+func digest(alg string, b []byte) string {
+	h := digestHash(alg)
+	h.Write(b)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// digestHash creates a hash for a supported algorithm, or returns nil.
+func digestHash(alg string) hash.Hash {
+	for _, a := range digestAlgorithms {
+		if a.name == alg {
+			return a.new()
+		}
+	}
+	return nil
+}
+
+// hasBody reports whether a request carries a body, either of a non-zero
+// Content-Length or with a transfer-encoding.
+func hasBody(req *Request) bool {
+	if _, ok := req.Headers["Transfer-Encoding"]; ok {
+		return true
+	}
+	length := req.Headers.Get("Content-Length")
+	return length != "" && length != "0"
+}
@@ -0,0 +1,126 @@
+package http_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestContentDigest(t *testing.T) {
+	const (
+		reqBody = `{"hello":"world"}`
+		resBody = `{"ok":true}`
+	)
+
+	var handled []byte
+	url := startServer(t, &http.ContentDigest{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			handled, _ = ioutil.ReadAll(req.Body)
+			res.Write([]byte(resBody))
+		}),
+	})
+
+	post := func(digest, want string) *stdhttp.Response {
+		req, err := stdhttp.NewRequest("POST", url, bytes.NewReader([]byte(reqBody)))
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("Content-Digest", digest)
+		if want != "" {
+			req.Header.Set("Want-Content-Digest", want)
+		}
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	reqSum := sha256.Sum256([]byte(reqBody))
+	resp := post("sha-256=:"+base64.StdEncoding.EncodeToString(reqSum[:])+":", "sha-256=1, sha-512=5")
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got: %v", resp.StatusCode)
+	}
+	if string(handled) != reqBody {
+		t.Fatalf("expected handler to read body '%s', got: '%s'", reqBody, handled)
+	}
+	resSum := sha512.Sum512([]byte(resBody))
+	if exp := "sha-512=:" + base64.StdEncoding.EncodeToString(resSum[:]) + ":"; resp.Header.Get("Content-Digest") != exp {
+		t.Fatalf("expected header 'Content-Digest' = %v, got: %v", exp, resp.Header.Get("Content-Digest"))
+	}
+
+	wrong := sha256.Sum256([]byte("something else"))
+	resp = post("sha-256=:"+base64.StdEncoding.EncodeToString(wrong[:])+":", "")
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected mismatched digest to get 400, got: %v", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Digest") != "" {
+		t.Fatal("expected no response digest when none was wanted")
+	}
+}
+
+func TestContentDigestRequire(t *testing.T) {
+	url := startServer(t, &http.ContentDigest{
+		Handler:      http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		Require:      true,
+		MaxBodyBytes: 4,
+	})
+	addr := strings.TrimPrefix(url, "http://")
+
+	cases := []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{
+			name:   "no body",
+			req:    "GET / HTTP/1.1\r\n\r\n",
+			status: 200,
+		},
+		{
+			name:   "content-length",
+			req:    "POST / HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello",
+			status: 400,
+		},
+		{
+			name:   "chunked",
+			req:    "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "body too large",
+			req:    "POST / HTTP/1.1\r\nContent-Digest: sha-256=:AAAA:\r\nContent-Length: 5\r\n\r\nhello",
+			status: 413,
+		},
+	}
+
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Header holds the headers of a request or response. Keys are canonical MIME
+// header keys, e.g. "Content-Type", and map to the values of every header of
+// that name in the order they were added. The methods canonicalize the key
+// they are given, so they are case insensitive; indexing the map directly
+// needs a canonical key.
+type Header map[string][]string
+
+// Add adds a value to those already held for key.
+func (h Header) Add(key, value string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// Set replaces any values held for key with value.
+func (h Header) Set(key, value string) {
+	h[textproto.CanonicalMIMEHeaderKey(key)] = []string{value}
+}
+
+// Get returns the first value held for key, or "" if there is none. Use
+// Values for headers that may be repeated.
+func (h Header) Get(key string) string {
+	if v := h[textproto.CanonicalMIMEHeaderKey(key)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Values returns every value held for key. The slice is not a copy.
+func (h Header) Values(key string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// Del removes every value held for key.
+func (h Header) Del(key string) {
+	delete(h, textproto.CanonicalMIMEHeaderKey(key))
+}
+
+// clone returns a deep copy of h.
+func (h Header) clone() Header {
+	c := make(Header, len(h))
+	for k, v := range h {
+		c[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// writeTo writes a line for every header value, sorted by key so that the
+// same headers are always sent the same way. Values of a repeated header keep
+// their order.
+func (h Header) writeTo(w io.Writer) error {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// singletonHeaders are request headers that may only appear once. Repeating
+// them is either meaningless or, in the case of Content-Length and Host, a
+// common way of smuggling requests past intermediaries that pick a different
+// copy than we do.
+var singletonHeaders = map[string]bool{
+	"Authorization":  true,
+	"Content-Length": true,
+	"Content-Type":   true,
+	"Host":           true,
+}
+
+// addHeader adds a parsed request header to headers. Repeated headers keep
+// every value, except for singleton headers, which may not be repeated.
+func addHeader(headers Header, key, val string) error {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if _, ok := headers[key]; ok && singletonHeaders[key] {
+		return fmt.Errorf("duplicate header: %q", key)
+	}
+
+	headers.Add(key, val)
+	return nil
+}
@@ -0,0 +1,163 @@
+package http_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestDuplicateHeaders(t *testing.T) {
+	var accept, cookie []string
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		accept, cookie = req.Headers.Values("Accept"), req.Headers.Values("cookie")
+	}))
+	addr := strings.TrimPrefix(url, "http://")
+
+	cases := []struct {
+		name   string
+		req    string
+		status int
+	}{
+		{
+			name:   "repeated values",
+			req:    "GET / HTTP/1.1\r\nAccept: text/html\r\naccept: application/json\r\nCookie: a=1\r\nCookie: b=2\r\n\r\n",
+			status: 200,
+		},
+		{
+			name:   "duplicate content-length",
+			req:    "POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\nab",
+			status: 400,
+		},
+		{
+			name:   "negative content-length",
+			req:    "POST / HTTP/1.1\r\nContent-Length: -5\r\n\r\nGET /smuggled HTTP/1.1\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "signed content-length",
+			req:    "POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello",
+			status: 400,
+		},
+		{
+			name:   "whitespace before colon",
+			req:    "POST / HTTP/1.1\r\nContent-Length : 26\r\n\r\nGET /smuggled HTTP/1.1\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "invalid field name",
+			req:    "GET / HTTP/1.1\r\nX(Bad): 1\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "no colon",
+			req:    "GET / HTTP/1.1\r\nNoColon\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "duplicate host",
+			req:    "GET / HTTP/1.1\r\nHost: a.example\r\nHost: b.example\r\n\r\n",
+			status: 400,
+		},
+	}
+
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, resp.StatusCode)
+		}
+	}
+
+	if exp := []string{"text/html", "application/json"}; !reflect.DeepEqual(accept, exp) {
+		t.Fatalf("expected accept %q, got: %q", exp, accept)
+	}
+	if exp := []string{"a=1", "b=2"}; !reflect.DeepEqual(cookie, exp) {
+		t.Fatalf("expected cookie %q, got: %q", exp, cookie)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Add("set-cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Set("content-TYPE", "text/plain")
+
+	if exp := []string{"a=1", "b=2"}; !reflect.DeepEqual(h.Values("SET-COOKIE"), exp) {
+		t.Fatalf("expected values %q, got: %q", exp, h.Values("SET-COOKIE"))
+	}
+	if v := h.Get("Set-Cookie"); v != "a=1" {
+		t.Fatalf("expected first value 'a=1', got: '%s'", v)
+	}
+	if _, ok := h["Content-Type"]; !ok {
+		t.Fatalf("expected canonical key 'Content-Type', got: %v", h)
+	}
+
+	h.Set("Set-Cookie", "c=3")
+	if v := h.Values("Set-Cookie"); len(v) != 1 || v[0] != "c=3" {
+		t.Fatalf("expected set to replace values, got: %q", v)
+	}
+	h.Del("set-cookie")
+	if v := h.Get("Set-Cookie"); v != "" {
+		t.Fatalf("expected deleted header to be empty, got: '%s'", v)
+	}
+}
+
+func TestResponseHeaderOrder(t *testing.T) {
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Headers.Set("X-Zebra", "z")
+		res.Headers.Add("Set-Cookie", "a=1")
+		res.Headers.Add("Set-Cookie", "b=2")
+		res.Headers.Set("Content-Type", "text/plain")
+	}))
+
+	// Map order is random, so a few tries would show up an unsorted write.
+	for i := 0; i < 5; i++ {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		raw, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal("unable to read response:", err)
+		}
+
+		// Leave out the status line and the date, which changes.
+		var lines []string
+		for _, ln := range strings.Split(string(raw), "\r\n")[1:] {
+			if ln == "" {
+				break
+			}
+			if !strings.HasPrefix(ln, "Date: ") {
+				lines = append(lines, ln)
+			}
+		}
+		headers := strings.Join(lines, "\n")
+
+		exp := "Content-Length: 0\nContent-Type: text/plain\nSet-Cookie: a=1\nSet-Cookie: b=2\nX-Zebra: z"
+		if headers != exp {
+			t.Fatalf("expected headers %q, got: %q", exp, headers)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// StoredResponse is a response recorded so that it can be replayed.
+type StoredResponse struct {
+	// Fingerprint identifies the request that produced the response so that a
+	// key reused for a different request can be detected.
+	Fingerprint string
+
+	Status  int
+	Headers Header
+	Body    []byte
+}
+
+// IdempotencyStore keeps responses by idempotency key. Implementations must be
+// safe for concurrent use.
+type IdempotencyStore interface {
+	// Get returns the response stored for key, if any.
+	Get(key string) (*StoredResponse, bool, error)
+	// Set stores a response for key until ttl has elapsed.
+	Set(key string, res *StoredResponse, ttl time.Duration) error
+}
+
+// DefaultIdempotencyTTL is how long an Idempotency keeps responses unless told
+// otherwise.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Idempotency is middleware for the Idempotency-Key header. The first
+// response to a request carrying a key is stored, and retries with the same
+// key get the stored response back instead of running the handler again. This
+// makes it safe for clients to retry requests such as payments.
+//
+// Safe methods (GET, HEAD, OPTIONS) are passed straight through. Server errors
+// are not stored so that they can be retried. A retry that arrives while the
+// original is still being handled gets 409, and reusing a key for a different
+// request gets 422. Keys are scoped to the caller, so one client cannot
+// replay another's response by guessing its key. The body is part of the
+// fingerprint, so requests with a body larger than MaxBodyBytes cannot be
+// made idempotent and are rejected with 413.
+type Idempotency struct {
+	Handler Handler
+	Store   IdempotencyStore
+
+	// TTL is how long responses are kept for. If zero,
+	// DefaultIdempotencyTTL is used.
+	TTL time.Duration
+
+	// Caller identifies who sent a request. If nil, the Authorization header
+	// is used.
+	Caller func(req *Request) string
+
+	// MaxBodyBytes caps the request body read to fingerprint a request. If
+	// zero, DefaultMaxBodyBytes is used.
+	MaxBodyBytes int64
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (id *Idempotency) ServeHTTP(res *Response, req *Request) {
+	key := req.Headers.Get("Idempotency-Key")
+	if key == "" || req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS" {
+		id.Handler.ServeHTTP(res, req)
+		return
+	}
+
+	body, err := readBody(req.Body, id.MaxBodyBytes)
+	if err == errBodyTooLarge {
+		res.WriteError(413, "request body is too large to fingerprint")
+		return
+	}
+	if err != nil {
+		res.WriteError(400, "unable to read body")
+		return
+	}
+	req.Body = bytes.NewReader(body)
+
+	caller := req.Headers.Get("Authorization")
+	if id.Caller != nil {
+		caller = id.Caller(req)
+	}
+	key = scopedKey(caller, key)
+	fingerprint := requestFingerprint(req, body)
+
+	if !id.begin(key) {
+		res.WriteError(409, "a request with this idempotency key is in progress")
+		return
+	}
+	defer id.end(key)
+
+	stored, ok, err := id.Store.Get(key)
+	if err != nil {
+		res.WriteError(500, "unable to look up idempotency key")
+		return
+	}
+	if ok {
+		if stored.Fingerprint != fingerprint {
+			res.WriteError(422, "idempotency key was used for a different request")
+			return
+		}
+		res.Status = stored.Status
+		for k, v := range stored.Headers.clone() {
+			res.Headers[k] = v
+		}
+		res.Headers.Set("Idempotent-Replayed", "true")
+		res.Write(stored.Body)
+		return
+	}
+
+	// Capture the response so that the whole of it can be stored. The capture
+	// only holds the headers the handler set, not per-connection ones.
+	captured := captureResponse(res)
+	id.Handler.ServeHTTP(captured, req)
+
+	if captured.Status >= 500 || captured.overflow {
+		copyResponse(res, captured)
+		return
+	}
+
+	stored = &StoredResponse{
+		Fingerprint: fingerprint,
+		Status:      captured.Status,
+		Headers:     captured.Headers,
+		Body:        append([]byte(nil), captured.buf.Bytes()...),
+	}
+	ttl := id.TTL
+	if ttl == 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	// A response that could not be stored would not be replayed, so the
+	// client must not be told that retrying is safe.
+	if err := id.Store.Set(key, stored, ttl); err != nil {
+		res.WriteError(500, "unable to store response for idempotency key")
+		return
+	}
+	copyResponse(res, captured)
+}
+
+// begin marks key as in flight, reporting false if it already was.
+func (id *Idempotency) begin(key string) bool {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	if id.inFlight == nil {
+		id.inFlight = make(map[string]bool)
+	}
+	if id.inFlight[key] {
+		return false
+	}
+	id.inFlight[key] = true
+	return true
+}
+
+// end clears the in flight mark for key.
+func (id *Idempotency) end(key string) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+
+	delete(id.inFlight, key)
+}
+
+// scopedKey combines an idempotency key with the caller that sent it. The
+// caller is hashed so that credentials are not kept in the store.
+func scopedKey(caller, key string) string {
+	sum := sha256.Sum256([]byte(caller))
+	return hex.EncodeToString(sum[:]) + ":" + key
+}
+
+// requestFingerprint identifies a request by its method, URI and body.
+func requestFingerprint(req *Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URI + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps responses in
+// memory. Expired responses are dropped when they are next looked up.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]storedEntry
+}
+
+// storedEntry is a StoredResponse along with its expiry.
+type storedEntry struct {
+	res     *StoredResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		responses: make(map[string]storedEntry),
+	}
+}
+
+// Get satisfies the IdempotencyStore interface.
+func (m *MemoryIdempotencyStore) Get(key string) (*StoredResponse, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.responses[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(m.responses, key)
+		return nil, false, nil
+	}
+
+	return e.res, true, nil
+}
+
+// Set satisfies the IdempotencyStore interface.
+func (m *MemoryIdempotencyStore) Set(key string, res *StoredResponse, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.responses[key] = storedEntry{
+		res:     res,
+		expires: time.Now().Add(ttl),
+	}
+	return nil
+}
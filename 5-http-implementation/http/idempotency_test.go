@@ -0,0 +1,147 @@
+package http_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestIdempotency(t *testing.T) {
+	var charges int32
+	url := startServer(t, &http.Idempotency{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			n := atomic.AddInt32(&charges, 1)
+			res.Status = 201
+			res.Headers.Set("X-Charge", strconv.Itoa(int(n)))
+			res.Write([]byte("charged"))
+		}),
+		Store:        http.NewMemoryIdempotencyStore(),
+		TTL:          time.Minute,
+		MaxBodyBytes: 64,
+	})
+
+	post := func(key, body string) (*stdhttp.Response, string) {
+		req, err := stdhttp.NewRequest("POST", url+"/charges", bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, string(b)
+	}
+
+	first, _ := post("abc", "amount=10")
+	retry, body := post("abc", "amount=10")
+
+	if c := atomic.LoadInt32(&charges); c != 1 {
+		t.Fatalf("expected handler to run once, ran %v times", c)
+	}
+	if retry.StatusCode != 201 || body != "charged" {
+		t.Fatalf("expected replayed 201 'charged', got: %v '%s'", retry.StatusCode, body)
+	}
+	if retry.Header.Get("X-Charge") != first.Header.Get("X-Charge") {
+		t.Fatalf("expected replayed header 'X-Charge' = %v, got: %v", first.Header.Get("X-Charge"), retry.Header.Get("X-Charge"))
+	}
+	if retry.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatal("expected header 'Idempotent-Replayed' on replay")
+	}
+
+	if resp, _ := post("abc", "amount=99"); resp.StatusCode != 422 {
+		t.Fatalf("expected reused key with different body to get 422, got: %v", resp.StatusCode)
+	}
+
+	if resp, _ := post("large", strings.Repeat("x", 65)); resp.StatusCode != 413 {
+		t.Fatalf("expected oversized body to get 413, got: %v", resp.StatusCode)
+	}
+
+	post("other", "amount=10")
+	if c := atomic.LoadInt32(&charges); c != 2 {
+		t.Fatalf("expected a new key to run the handler, ran %v times", c)
+	}
+}
+
+func TestIdempotencyCallers(t *testing.T) {
+	var charges int32
+	url := startServer(t, &http.Idempotency{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			atomic.AddInt32(&charges, 1)
+			res.Write([]byte("charged " + req.Headers.Get("Authorization")))
+		}),
+		// No TTL, so the default applies rather than nothing being kept.
+		Store: http.NewMemoryIdempotencyStore(),
+	})
+
+	post := func(auth string) string {
+		req, err := stdhttp.NewRequest("POST", url+"/charges", bytes.NewReader([]byte("amount=10")))
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("Idempotency-Key", "abc")
+		req.Header.Set("Authorization", auth)
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("%s: expected status code 200, got: %v", auth, resp.StatusCode)
+		}
+		return string(b)
+	}
+
+	for _, auth := range []string{"alice", "bob", "alice", "bob"} {
+		if body := post(auth); body != "charged "+auth {
+			t.Fatalf("%s: expected body 'charged %s', got: '%s'", auth, auth, body)
+		}
+	}
+	if c := atomic.LoadInt32(&charges); c != 2 {
+		t.Fatalf("expected handler to run once per caller, ran %v times", c)
+	}
+}
+
+// failingStore is an IdempotencyStore that cannot store anything.
+type failingStore struct{}
+
+func (failingStore) Get(string) (*http.StoredResponse, bool, error) { return nil, false, nil }
+
+func (failingStore) Set(string, *http.StoredResponse, time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func TestIdempotencyStoreFailure(t *testing.T) {
+	url := startServer(t, &http.Idempotency{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			res.Write([]byte("charged"))
+		}),
+		Store: failingStore{},
+	})
+
+	req, err := stdhttp.NewRequest("POST", url+"/charges", bytes.NewReader([]byte("amount=10")))
+	if err != nil {
+		t.Fatal("unable to create request:", err)
+	}
+	req.Header.Set("Idempotency-Key", "abc")
+	resp, err := stdhttp.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("post failed:", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 500 {
+		t.Fatalf("expected status code 500 when the response cannot be stored, got: %v", resp.StatusCode)
+	}
+}
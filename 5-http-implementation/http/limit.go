@@ -0,0 +1,154 @@
+package http
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimit caps how many requests can be inside Handler at once. It is
+// meant to wrap individual expensive handlers (reports, exports) so that each
+// gets its own limit. A request that finds every slot taken waits up to Wait
+// for one to free up before being turned away.
+type ConcurrencyLimit struct {
+	Handler Handler
+
+	// Max is the number of concurrent executions allowed. Zero or less
+	// means no limit, as it does for Server.MaxHandlers.
+	Max int
+	// Wait is how long a request may queue for a free slot.
+	Wait time.Duration
+	// Status is sent when a request could not get a slot in time. It defaults
+	// to 429 Too Many Requests; 503 is the other common choice.
+	Status int
+
+	slots chan struct{}
+	init  sync.Once
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (cl *ConcurrencyLimit) ServeHTTP(res *Response, req *Request) {
+	if cl.Max <= 0 {
+		cl.Handler.ServeHTTP(res, req)
+		return
+	}
+	cl.init.Do(func() {
+		cl.slots = make(chan struct{}, cl.Max)
+	})
+
+	if !cl.acquire() {
+		status := cl.Status
+		if status == 0 {
+			status = 429
+		}
+		res.WriteError(status, "too many concurrent requests")
+		return
+	}
+	defer func() { <-cl.slots }()
+
+	cl.Handler.ServeHTTP(res, req)
+}
+
+// acquire takes a slot, waiting up to Wait for one, and reports whether it
+// got one.
+func (cl *ConcurrencyLimit) acquire() bool {
+	// Take a free slot straight away if there is one. Otherwise, with no Wait,
+	// an already expired timer would race the free slot.
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if cl.Wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(cl.Wait)
+	defer timer.Stop()
+
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// MaxBodySize caps the size of request bodies that reach Handler. Like
+// ConcurrencyLimit it is meant to wrap individual handlers, such as ServeMux
+// routes, so that each gets its own limit: small for JSON APIs and large for
+// uploads.
+//
+// A request whose Content-Length is over Limit is rejected with 413 without
+// running Handler. For a chunked body, whose length is not known up front,
+// reads fail once more than Limit bytes have arrived and the response is
+// replaced with a 413. The response is held back to make that possible.
+type MaxBodySize struct {
+	Handler Handler
+
+	// Limit is the largest body allowed, in bytes. Zero or less means no
+	// limit.
+	Limit int64
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (mb *MaxBodySize) ServeHTTP(res *Response, req *Request) {
+	if mb.Limit <= 0 {
+		mb.Handler.ServeHTTP(res, req)
+		return
+	}
+
+	if v := req.Headers.Get("Content-Length"); v != "" {
+		// The server has checked the length is valid and caps the body at it.
+		if n, _ := strconv.ParseInt(v, 10, 64); n > mb.Limit {
+			res.WriteError(413, "request body is too large")
+			return
+		}
+		mb.Handler.ServeHTTP(res, req)
+		return
+	}
+	if _, ok := req.Headers["Transfer-Encoding"]; !ok {
+		mb.Handler.ServeHTTP(res, req)
+		return
+	}
+
+	body := &maxBodyReader{r: req.Body, n: mb.Limit}
+	req.Body = body
+
+	captured := captureResponse(res)
+	mb.Handler.ServeHTTP(captured, req)
+	if body.exceeded {
+		res.WriteError(413, "request body is too large")
+		return
+	}
+	copyResponse(res, captured)
+}
+
+// maxBodyReader reads at most n more bytes from r, failing with
+// errBodyTooLarge if there are more.
+type maxBodyReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+// Read satisfies the io.Reader interface.
+func (mr *maxBodyReader) Read(p []byte) (int, error) {
+	if mr.exceeded {
+		return 0, errBodyTooLarge
+	}
+
+	// Ask for one byte more than is allowed, to tell a body that ends right
+	// at the limit from one that goes on past it.
+	if int64(len(p)) > mr.n+1 {
+		p = p[:mr.n+1]
+	}
+	n, err := mr.r.Read(p)
+	if int64(n) > mr.n {
+		n, mr.n, mr.exceeded = int(mr.n), 0, true
+		return n, errBodyTooLarge
+	}
+	mr.n -= int64(n)
+	return n, err
+}
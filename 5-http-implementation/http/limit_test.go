@@ -0,0 +1,156 @@
+package http_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	url := startServer(t, &http.ConcurrencyLimit{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			started <- struct{}{}
+			<-release
+		}),
+		Max:  1,
+		Wait: 50 * time.Millisecond,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := stdhttp.Get(url); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	// With the only slot taken this request should wait and then give up.
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 429 {
+		t.Fatalf("expected status code 429, got: %v", resp.StatusCode)
+	}
+
+	// A request that arrives while the slot frees up should get it.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	resp, err = stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected queued request to succeed, got: %v", resp.StatusCode)
+	}
+	<-done
+}
+
+func TestConcurrencyLimitIdle(t *testing.T) {
+	for _, max := range []int{10, 0} {
+		url := startServer(t, &http.ConcurrencyLimit{
+			Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+			Max:     max,
+		})
+
+		// With no Wait, sequential requests should still always find a slot.
+		for i := 0; i < 100; i++ {
+			resp, err := stdhttp.Get(url)
+			if err != nil {
+				t.Fatal("get failed:", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatalf("max %v: expected request %v to get 200, got: %v", max, i, resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	echo := http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			res.WriteError(400, "unable to read body")
+			return
+		}
+		res.Write(body)
+	})
+	mux := &http.ServeMux{}
+	mux.Post("/api", &http.MaxBodySize{Handler: echo, Limit: 5})
+	mux.Post("/upload", &http.MaxBodySize{Handler: echo, Limit: 1 << 20})
+	addr := strings.TrimPrefix(startServer(t, mux), "http://")
+
+	cases := []struct {
+		name   string
+		req    string
+		status int
+		body   string
+	}{
+		{
+			name:   "within limit",
+			req:    "POST /api HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello",
+			status: 200,
+			body:   "hello",
+		},
+		{
+			name:   "content-length over limit",
+			req:    "POST /api HTTP/1.1\r\nContent-Length: 6\r\n\r\nhello!",
+			status: 413,
+		},
+		{
+			name:   "chunked within limit",
+			req:    "POST /api HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhe\r\n3\r\nllo\r\n0\r\n\r\n",
+			status: 200,
+			body:   "hello",
+		},
+		{
+			name:   "chunked over limit",
+			req:    "POST /api HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhel\r\n3\r\nlo!\r\n0\r\n\r\n",
+			status: 413,
+		},
+		{
+			name:   "larger limit on another route",
+			req:    "POST /upload HTTP/1.1\r\nContent-Length: 6\r\n\r\nhello!",
+			status: 200,
+			body:   "hello!",
+		},
+	}
+
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, resp.StatusCode)
+		}
+		if c.body != "" && string(body) != c.body {
+			t.Fatalf("%s: expected body '%s', got: '%s'", c.name, c.body, body)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package http
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ServeMux routes requests to handlers by method and path.
+//
+// Patterns are paths made up of segments separated by '/'. A segment can be a
+// literal, which must match exactly, a parameter such as ":id", which matches
+// any single segment, or, as the last segment only, a wildcard such as
+// "*path", which matches the rest of the path including any further slashes.
+// What parameters and wildcards match is put in Request.Params. Patterns are
+// matched against the decoded URL path.
+//
+// When several patterns match a path the most specific wins: segment by
+// segment, a literal beats a parameter, which beats a wildcard. Requests that
+// match no pattern get a 404, and those whose path matches but whose method
+// does not get a 405 listing the allowed methods in an Allow header. HEAD
+// requests are handled by GET routes when no route accepts HEAD itself.
+//
+// The zero value is ready to use.
+type ServeMux struct {
+	mu     sync.RWMutex
+	routes []*route
+}
+
+// route is a pattern registered with a ServeMux.
+type route struct {
+	// method is empty for routes that match any method.
+	method   string
+	segments []string
+	handler  Handler
+}
+
+// Handle registers a handler for pattern that accepts any method. It panics if
+// the pattern is malformed or already registered.
+func (mux *ServeMux) Handle(pattern string, h Handler) {
+	mux.Method("", pattern, h)
+}
+
+// HandleFunc registers a handler function for pattern that accepts any method.
+func (mux *ServeMux) HandleFunc(pattern string, f func(*Response, *Request)) {
+	mux.Handle(pattern, HandlerFunc(f))
+}
+
+// Get registers a handler for GET requests to pattern.
+func (mux *ServeMux) Get(pattern string, h Handler) { mux.Method("GET", pattern, h) }
+
+// Post registers a handler for POST requests to pattern.
+func (mux *ServeMux) Post(pattern string, h Handler) { mux.Method("POST", pattern, h) }
+
+// Put registers a handler for PUT requests to pattern.
+func (mux *ServeMux) Put(pattern string, h Handler) { mux.Method("PUT", pattern, h) }
+
+// Patch registers a handler for PATCH requests to pattern.
+func (mux *ServeMux) Patch(pattern string, h Handler) { mux.Method("PATCH", pattern, h) }
+
+// Delete registers a handler for DELETE requests to pattern.
+func (mux *ServeMux) Delete(pattern string, h Handler) { mux.Method("DELETE", pattern, h) }
+
+// Method registers a handler for requests to pattern with the given method,
+// or with any method if method is empty. It panics if the pattern is
+// malformed or already registered for the method.
+func (mux *ServeMux) Method(method, pattern string, h Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for _, r := range mux.routes {
+		if r.method == method && samePattern(r.segments, segments) {
+			panic(fmt.Sprintf("http: multiple registrations for %s %s", method, pattern))
+		}
+	}
+	mux.routes = append(mux.routes, &route{
+		method:   method,
+		segments: segments,
+		handler:  h,
+	})
+}
+
+// ServeHTTP satisfies the Handler interface by dispatching to the handler
+// registered for the request.
+func (mux *ServeMux) ServeHTTP(res *Response, req *Request) {
+	path := req.URL.Path
+	segments := splitPath(path)
+
+	mux.mu.RLock()
+	var (
+		best       *route
+		bestScore  []int
+		bestParams map[string]string
+		allowed    = make(map[string]bool)
+
+		// get is the best GET route, which HEAD falls back to.
+		get       *route
+		getScore  []int
+		getParams map[string]string
+	)
+	for _, r := range mux.routes {
+		params, score, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+		if r.method == "GET" {
+			allowed["HEAD"] = true
+			if req.Method == "HEAD" && (get == nil || moreSpecific(score, getScore)) {
+				get, getScore, getParams = r, score, params
+			}
+		}
+		if r.method != "" && r.method != req.Method {
+			allowed[r.method] = true
+			continue
+		}
+		if best == nil || moreSpecific(score, bestScore) {
+			best, bestScore, bestParams = r, score, params
+		}
+	}
+	mux.mu.RUnlock()
+
+	if best == nil {
+		best, bestParams = get, getParams
+	}
+
+	if best == nil {
+		if len(allowed) == 0 {
+			res.WriteError(404, "no route for "+path)
+			return
+		}
+
+		methods := make([]string, 0, len(allowed))
+		for m := range allowed {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		res.Headers.Set("Allow", strings.Join(methods, ", "))
+		res.WriteError(405, req.Method+" not allowed for "+path)
+		return
+	}
+
+	req.Params = bestParams
+	best.handler.ServeHTTP(res, req)
+}
+
+// match reports whether the route's pattern matches a path, along with the
+// parameters it captured and a score for how specific the match was.
+func (r *route) match(path []string) (params map[string]string, score []int, ok bool) {
+	score = make([]int, 0, len(r.segments))
+	for i, seg := range r.segments {
+		switch {
+		case kindOf(seg) == wildcardSegment:
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = strings.Join(path[i:], "/")
+			return params, append(score, int(wildcardSegment)), true
+		case i >= len(path):
+			return nil, nil, false
+		case kindOf(seg) == paramSegment:
+			if path[i] == "" {
+				return nil, nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:]] = path[i]
+			score = append(score, int(paramSegment))
+		case seg == path[i]:
+			score = append(score, int(literalSegment))
+		default:
+			return nil, nil, false
+		}
+	}
+
+	if len(path) != len(r.segments) {
+		return nil, nil, false
+	}
+	return params, score, true
+}
+
+// moreSpecific reports whether score a beats score b, comparing segment by
+// segment.
+func moreSpecific(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return len(a) > len(b)
+}
+
+// parsePattern splits a pattern into segments, checking that it is well
+// formed.
+func parsePattern(pattern string) ([]string, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("http: pattern %q must start with '/'", pattern)
+	}
+
+	segments := splitPath(pattern)
+	names := make(map[string]bool)
+	for i, seg := range segments {
+		k := kindOf(seg)
+		if k == literalSegment {
+			continue
+		}
+		if len(seg) == 1 {
+			return nil, fmt.Errorf("http: pattern %q has an unnamed parameter", pattern)
+		}
+		if k == wildcardSegment && i != len(segments)-1 {
+			return nil, fmt.Errorf("http: pattern %q has a wildcard before the end", pattern)
+		}
+		if names[seg[1:]] {
+			return nil, fmt.Errorf("http: pattern %q repeats parameter %q", pattern, seg[1:])
+		}
+		names[seg[1:]] = true
+	}
+	return segments, nil
+}
+
+// samePattern reports whether two patterns match exactly the same paths, which
+// is the case when they only differ by parameter names.
+func samePattern(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		k := kindOf(a[i])
+		if k != kindOf(b[i]) || (k == literalSegment && a[i] != b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentKind is what a pattern segment matches. Kinds are ordered by how
+// specific they are, from least to most.
+type segmentKind int
+
+const (
+	wildcardSegment segmentKind = iota
+	paramSegment
+	literalSegment
+)
+
+// kindOf classifies a pattern segment.
+func kindOf(seg string) segmentKind {
+	switch {
+	case strings.HasPrefix(seg, ":"):
+		return paramSegment
+	case strings.HasPrefix(seg, "*"):
+		return wildcardSegment
+	}
+	return literalSegment
+}
+
+// splitPath splits a path into its segments, e.g. "/a/b" into "a" and "b". The
+// root path "/" is a single empty segment.
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
@@ -0,0 +1,100 @@
+package http_test
+
+import (
+	"io/ioutil"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestServeMux(t *testing.T) {
+	reply := func(name string) http.Handler {
+		return http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			res.Write([]byte(name))
+			for _, k := range []string{"id", "path"} {
+				if v, ok := req.Params[k]; ok {
+					res.Write([]byte(" " + k + "=" + v))
+				}
+			}
+		})
+	}
+
+	mux := &http.ServeMux{}
+	mux.HandleFunc("/", func(res *http.Response, req *http.Request) {
+		res.Write([]byte("root"))
+	})
+	mux.Get("/users/:id", reply("get user"))
+	mux.Delete("/users/:id", reply("delete user"))
+	mux.Get("/users/me", reply("me"))
+	mux.Handle("/static/*path", reply("static"))
+	url := startServer(t, mux)
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		body   string
+		allow  string
+	}{
+		{method: "GET", path: "/", status: 200, body: "root"},
+		{method: "GET", path: "/users/42?verbose=1", status: 200, body: "get user id=42"},
+		{method: "DELETE", path: "/users/42", status: 200, body: "delete user id=42"},
+		{method: "GET", path: "/users/me", status: 200, body: "me"},
+		{method: "POST", path: "/static/css/site.css", status: 200, body: "static path=css/site.css"},
+		{method: "GET", path: "/users", status: 404},
+		{method: "GET", path: "/users/42/posts", status: 404},
+		{method: "HEAD", path: "/users/42", status: 200},
+		{method: "GET", path: "/users/me", status: 200, body: "me"},
+		{method: "PUT", path: "/users/42", status: 405, allow: "DELETE, GET, HEAD"},
+	}
+
+	for _, c := range cases {
+		req, err := stdhttp.NewRequest(c.method, url+c.path, nil)
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: request failed: %v", c.method, c.path, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s %s: expected status code %v, got: %v", c.method, c.path, c.status, resp.StatusCode)
+		}
+		if c.body != "" && string(body) != c.body {
+			t.Fatalf("%s %s: expected body '%s', got: '%s'", c.method, c.path, c.body, body)
+		}
+		if allow := resp.Header.Get("Allow"); allow != c.allow {
+			t.Fatalf("%s %s: expected allow '%s', got: '%s'", c.method, c.path, c.allow, allow)
+		}
+	}
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	h := http.HandlerFunc(func(res *http.Response, req *http.Request) {})
+
+	for _, pattern := range []string{"users", "/users/:", "/files/*path/raw", "/a/:id/:id"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected pattern '%s' to be rejected", pattern)
+				}
+			}()
+			(&http.ServeMux{}).Handle(pattern, h)
+		}()
+	}
+
+	mux := &http.ServeMux{}
+	mux.Get("/users/:id", h)
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(r.(string), "multiple registrations") {
+			t.Fatalf("expected duplicate registration to panic, got: %v", r)
+		}
+	}()
+	mux.Get("/users/:name", h)
+}
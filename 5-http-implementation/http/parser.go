@@ -0,0 +1,125 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errHeadersTooLarge is returned when the request line and headers exceed the
+// parser's limit.
+var errHeadersTooLarge = errors.New("request headers too large")
+
+// parseState is the part of a request that a requestParser expects next.
+type parseState int
+
+const (
+	parseRequestLineState parseState = iota
+	parseHeadersState
+	parseDoneState
+)
+
+// requestParser incrementally parses the request line and headers of an HTTP
+// request. Input can be fed in whatever pieces it arrives in; a line split over
+// several calls to feed is carried over until its newline shows up. This means
+// parsing does not depend on a blocking reader, so the same parser can be
+// driven by a bufio.Reader, an event loop or a fuzzer.
+type requestParser struct {
+	state parseState
+	req   *Request
+
+	// line holds a partial line left over from the last call to feed.
+	line []byte
+
+	// size counts the bytes consumed so far, which may not exceed limit unless
+	// limit is zero.
+	size  int
+	limit int
+}
+
+// newRequestParser creates a parser for a new request. A non-zero limit caps
+// the combined length of the request line and headers.
+func newRequestParser(limit int) *requestParser {
+	return &requestParser{
+		limit: limit,
+		req: &Request{
+			Headers: make(Header),
+		},
+	}
+}
+
+// feed consumes bytes from b and returns how many were used. done is set once
+// the empty line that ends the headers has been consumed, at which point any
+// unused bytes belong to the body. Calling feed after done is a no-op.
+func (p *requestParser) feed(b []byte) (n int, done bool, err error) {
+	for p.state != parseDoneState {
+		i := bytes.IndexByte(b[n:], '\n')
+		if i < 0 {
+			// Wait for the rest of the line.
+			p.size += len(b) - n
+			p.line = append(p.line, b[n:]...)
+			return len(b), false, p.checkSize()
+		}
+
+		p.size += i + 1
+		if err := p.checkSize(); err != nil {
+			return n, false, err
+		}
+
+		p.line = append(p.line, b[n:n+i+1]...)
+		n += i + 1
+
+		// Keep the line exactly as it was received.
+		if p.state == parseRequestLineState {
+			p.req.RawRequestLine = string(p.line)
+		} else {
+			p.req.RawHeaders = append(p.req.RawHeaders, p.line...)
+		}
+
+		ln := strings.TrimSuffix(string(p.line), "\r\n")
+		p.line = p.line[:0]
+
+		if err := p.parseLine(ln); err != nil {
+			return n, false, err
+		}
+	}
+
+	return n, true, nil
+}
+
+// checkSize fails once more bytes have been consumed than the limit allows.
+func (p *requestParser) checkSize() error {
+	if p.limit > 0 && p.size > p.limit {
+		return errHeadersTooLarge
+	}
+	return nil
+}
+
+// parseLine handles a single complete line (with the crlf stripped off)
+// according to the current state.
+func (p *requestParser) parseLine(ln string) error {
+	switch p.state {
+	case parseRequestLineState:
+		var ok bool
+		if p.req.Method, p.req.URI, p.req.Proto, ok = parseRequestLine(ln); !ok {
+			return fmt.Errorf("malformed request line: %q", ln)
+		}
+		p.state = parseHeadersState
+
+	case parseHeadersState:
+		// An empty line marks the end of the headers.
+		if len(ln) == 0 {
+			p.state = parseDoneState
+			return nil
+		}
+
+		key, val, ok := parseHeaderLine(ln)
+		if !ok {
+			return fmt.Errorf("malformed header line: %q", ln)
+		}
+		return addHeader(p.req.Headers, key, val)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package http_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestPartialRequest(t *testing.T) {
+	const raw = "POST /split HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello"
+
+	var uri, host, body string
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		uri, host, body = req.URI, req.Headers.Get("Host"), string(b)
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+
+	// Trickle the request in so that lines are split across reads.
+	for i := 0; i < len(raw); i += 3 {
+		end := i + 3
+		if end > len(raw) {
+			end = len(raw)
+		}
+		if _, err := conn.Write([]byte(raw[i:end])); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got: %v", resp.StatusCode)
+	}
+	if exp := "/split"; uri != exp {
+		t.Fatalf("expected uri '%s', got: '%s'", exp, uri)
+	}
+	if exp := "localhost"; host != exp {
+		t.Fatalf("expected host '%s', got: '%s'", exp, host)
+	}
+	if exp := "hello"; body != exp {
+		t.Fatalf("expected body '%s', got: '%s'", exp, body)
+	}
+}
+
+func TestRawHeaders(t *testing.T) {
+	const (
+		line    = "GET /raw HTTP/1.1\r\n"
+		headers = "host:localhost\r\nX-Odd-Case:  spaced \r\n\r\n"
+	)
+
+	var rawLine, rawHeaders string
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		rawLine, rawHeaders = req.RawRequestLine, string(req.RawHeaders)
+	}))
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(line + headers)); err != nil {
+		t.Fatal("unable to write request:", err)
+	}
+	resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	resp.Body.Close()
+
+	if rawLine != line {
+		t.Fatalf("expected raw request line %q, got: %q", line, rawLine)
+	}
+	if rawHeaders != headers {
+		t.Fatalf("expected raw headers %q, got: %q", headers, rawHeaders)
+	}
+}
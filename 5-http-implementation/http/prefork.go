@@ -0,0 +1,110 @@
+package http
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// preforkChildEnv marks a process started by Prefork as a worker rather than
+// the parent.
+const preforkChildEnv = "LEARNING_HTTP_PREFORK_CHILD"
+
+// preforkStopGrace is how long workers are given to exit after the parent
+// passes on a termination signal, before they are killed.
+const preforkStopGrace = 10 * time.Second
+
+// Prefork serves on addr from n worker processes that each run their own
+// accept loop on a socket bound with SO_REUSEPORT, letting the kernel spread
+// connections between them. This sidesteps the garbage collector and lock
+// contention limits of a single process on large machines.
+//
+// The calling program is re-executed for every worker, so Prefork should be
+// called early in main with the same configuration in every process. In the
+// parent it waits for the workers and returns when one of them exits, or when
+// the parent gets SIGINT or SIGTERM, which it passes on to the workers first.
+// Workers are killed if the parent dies. In a worker it serves until the
+// listener fails.
+func (s *Server) Prefork(addr string, n int) error {
+	if os.Getenv(preforkChildEnv) != "" {
+		l, err := listenReusePort(addr)
+		if err != nil {
+			return err
+		}
+		return s.Serve(l)
+	}
+
+	if n < 1 {
+		return fmt.Errorf("prefork: invalid worker count: %v", n)
+	}
+
+	// Bind once in the parent so that problems such as the port being in use
+	// are reported before any workers are started. The socket is closed
+	// straight away, as the kernel would otherwise hand it a share of the
+	// connections that the parent never accepts.
+	l, err := listenReusePort(addr)
+	if err != nil {
+		return err
+	}
+	l.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	exited := make(chan error, n)
+	workers := make([]*exec.Cmd, 0, n)
+	for i := 0; i < n; i++ {
+		cmd := exec.Command(self, os.Args[1:]...)
+		cmd.Env = append(os.Environ(), preforkChildEnv+"="+strconv.Itoa(i))
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.SysProcAttr = workerAttr()
+		if err := cmd.Start(); err != nil {
+			killAll(workers)
+			return err
+		}
+		workers = append(workers, cmd)
+
+		go func() { exited <- cmd.Wait() }()
+	}
+
+	select {
+	case err = <-exited:
+	case sig := <-sigs:
+		// Give the workers the chance to shut down cleanly.
+		for _, w := range workers {
+			w.Process.Signal(sig)
+		}
+		timeout := time.After(preforkStopGrace)
+		for range workers {
+			select {
+			case <-exited:
+			case <-timeout:
+			}
+		}
+		killAll(workers)
+		return fmt.Errorf("prefork: %v", sig)
+	}
+
+	killAll(workers)
+	if err == nil {
+		err = fmt.Errorf("prefork: worker exited")
+	}
+	return err
+}
+
+// killAll stops every started worker process.
+func killAll(workers []*exec.Cmd) {
+	for _, w := range workers {
+		w.Process.Kill()
+	}
+}
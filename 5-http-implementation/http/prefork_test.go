@@ -0,0 +1,55 @@
+package http_test
+
+import (
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestPreforkWorker(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("prefork is only supported on Linux")
+	}
+
+	// Find a free port, as a worker does not report the one it picked.
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// Running as a worker serves on addr without starting any processes.
+	t.Setenv("LEARNING_HTTP_PREFORK_CHILD", "0")
+	s := &http.Server{Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Write([]byte("worker"))
+	})}
+	served := make(chan error, 1)
+	go func() { served <- s.Prefork(addr, 1) }()
+
+	var resp *stdhttp.Response
+	for i := 0; ; i++ {
+		if resp, err = stdhttp.Get("http://" + addr); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal("get failed:", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "worker" {
+		t.Fatalf("expected body 'worker', got: '%s'", body)
+	}
+
+	s.Close()
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("expected %v, got: %v", http.ErrServerClosed, err)
+	}
+}
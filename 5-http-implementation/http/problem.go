@@ -0,0 +1,46 @@
+package http
+
+import "encoding/json"
+
+// problemContentType is the media type of RFC 9457 problem details.
+const problemContentType = "application/problem+json"
+
+// WriteError sets the response status and writes an error body. Normally the
+// body is detail as plain text, or nothing if detail is empty. When the Server
+// has ProblemJSON enabled the body is instead an RFC 9457 problem details
+// document, which API clients can parse.
+//
+// Every error response generated by this package goes through WriteError so
+// that the format is consistent.
+func (res *Response) WriteError(status int, detail string) {
+	res.writeProblem(status, detail, nil)
+}
+
+// writeProblem is WriteError with extension members to add to a problem
+// details document.
+func (res *Response) writeProblem(status int, detail string, extensions map[string]interface{}) {
+	res.Status = status
+
+	if !res.problem {
+		if detail != "" {
+			res.Headers.Set("Content-Type", "text/plain")
+			res.Write([]byte(detail))
+		}
+		return
+	}
+
+	doc := make(map[string]interface{}, len(extensions)+4)
+	for k, v := range extensions {
+		doc[k] = v
+	}
+	doc["type"] = "about:blank"
+	doc["title"] = statusTitles[status]
+	doc["status"] = status
+	if detail != "" {
+		doc["detail"] = detail
+	}
+
+	btys, _ := json.Marshal(doc)
+	res.Headers.Set("Content-Type", problemContentType)
+	res.Write(btys)
+}
@@ -0,0 +1,61 @@
+package http_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestProblemJSON(t *testing.T) {
+	url := serveOn(t, &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			res.WriteError(404, "no such user")
+		}),
+		ProblemJSON: true,
+	})
+
+	type problem struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Detail string `json:"detail"`
+	}
+	check := func(resp *stdhttp.Response, exp problem) {
+		defer resp.Body.Close()
+
+		if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("expected header 'Content-Type' = application/problem+json, got: %v", ct)
+		}
+		var got problem
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal("unable to decode problem:", err)
+		}
+		if got != exp {
+			t.Fatalf("expected problem %+v, got: %+v", exp, got)
+		}
+	}
+
+	resp, err := stdhttp.Get(url + "/users/1")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	check(resp, problem{"about:blank", "Not Found", 404, "no such user"})
+
+	// Errors generated while parsing should be rendered the same way.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("NOT HTTP\r\n\r\n"))
+	resp, err = stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	check(resp, problem{"about:blank", "Bad Request", 400, `malformed request line: "NOT HTTP"`})
+}
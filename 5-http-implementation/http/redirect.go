@@ -0,0 +1,72 @@
+package http
+
+import (
+	"net"
+	"strings"
+)
+
+// acmeChallengePrefix is where ACME HTTP-01 challenges are requested.
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// HTTPSRedirect is a Handler that sends every request to the HTTPS version of
+// its URL, keeping the host, path and query.
+type HTTPSRedirect struct {
+	// Port is added to redirect URLs when the HTTPS server is not on 443.
+	Port string
+
+	// Challenge, if set, answers ACME HTTP-01 challenges. It is given the token
+	// from the request path and returns the key authorization to respond with,
+	// or false if the token is unknown.
+	Challenge func(token string) (string, bool)
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (hr *HTTPSRedirect) ServeHTTP(res *Response, req *Request) {
+	if hr.Challenge != nil && strings.HasPrefix(req.URL.Path, acmeChallengePrefix) {
+		token := strings.TrimPrefix(req.URL.Path, acmeChallengePrefix)
+		keyAuth, ok := hr.Challenge(token)
+		if !ok {
+			res.WriteError(404, "unknown challenge token")
+			return
+		}
+		res.Headers.Set("Content-Type", "text/plain")
+		res.Write([]byte(keyAuth))
+		return
+	}
+
+	host := req.Headers.Get("Host")
+	if host == "" {
+		res.WriteError(400, "missing host header")
+		return
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else {
+		// An IPv6 address without a port is still bracketed.
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	}
+	if hr.Port != "" && hr.Port != "443" {
+		host = net.JoinHostPort(host, hr.Port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	// The request URI may be in absolute form, in which case only its path
+	// and query are kept.
+	res.Status = 301
+	res.Headers.Set("Location", "https://"+host+req.URL.RequestURI())
+}
+
+// ListenAndRedirectHTTPS listens on addr (usually ":80") and serves hr on it
+// until the listener fails.
+func ListenAndRedirectHTTPS(addr string, hr *HTTPSRedirect) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s := Server{
+		Handler: hr,
+	}
+	return s.Serve(l)
+}
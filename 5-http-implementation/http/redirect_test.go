@@ -0,0 +1,121 @@
+package http_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	url := startServer(t, &http.HTTPSRedirect{
+		Port: "8443",
+		Challenge: func(token string) (string, bool) {
+			return token + ".thumbprint", token == "known"
+		},
+	})
+	client := stdhttp.Client{
+		CheckRedirect: func(*stdhttp.Request, []*stdhttp.Request) error {
+			return stdhttp.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(url + "/users?id=1")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 301 {
+		t.Fatalf("expected status code 301, got: %v", resp.StatusCode)
+	}
+	if exp := "https://localhost:8443/users?id=1"; resp.Header.Get("Location") != exp {
+		t.Fatalf("expected header 'Location' = %v, got: %v", exp, resp.Header.Get("Location"))
+	}
+
+	resp, err = client.Get(url + "/.well-known/acme-challenge/known")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if exp := "known.thumbprint"; string(body) != exp {
+		t.Fatalf("expected body '%s', got: '%s'", exp, body)
+	}
+
+	// The token comes from the path alone.
+	resp, err = client.Get(url + "/.well-known/acme-challenge/known?x=1")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if exp := "known.thumbprint"; string(body) != exp {
+		t.Fatalf("expected body '%s', got: '%s'", exp, body)
+	}
+
+	resp, err = client.Get(url + "/.well-known/acme-challenge/unknown")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Fatalf("expected status code 404, got: %v", resp.StatusCode)
+	}
+}
+
+func TestHTTPSRedirectLocation(t *testing.T) {
+	cases := []struct {
+		name     string
+		port     string
+		req      string
+		location string
+	}{
+		{
+			name:     "ipv6 host",
+			port:     "8443",
+			req:      "GET /a HTTP/1.1\r\nHost: [::1]\r\n\r\n",
+			location: "https://[::1]:8443/a",
+		},
+		{
+			name:     "ipv6 host and port",
+			port:     "8443",
+			req:      "GET /a HTTP/1.1\r\nHost: [::1]:8080\r\n\r\n",
+			location: "https://[::1]:8443/a",
+		},
+		{
+			name:     "ipv6 host on default port",
+			req:      "GET /a HTTP/1.1\r\nHost: [::1]:8080\r\n\r\n",
+			location: "https://[::1]/a",
+		},
+		{
+			name:     "absolute form",
+			req:      "GET http://example.com/a?b=1 HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			location: "https://example.com/a?b=1",
+		},
+	}
+
+	for _, c := range cases {
+		url := startServer(t, &http.HTTPSRedirect{Port: c.port})
+		conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		resp.Body.Close()
+		conn.Close()
+
+		if loc := resp.Header.Get("Location"); loc != c.location {
+			t.Fatalf("%s: expected header 'Location' = %v, got: %v", c.name, c.location, loc)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// listenReusePort listens on addr with SO_REUSEPORT set so that several
+// processes can accept connections on the same port.
+func listenReusePort(addr string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var serr error
+			err := c.Control(func(fd uintptr) {
+				serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		},
+	}
+
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// workerAttr is how Prefork starts workers: they are killed if the parent
+// dies, rather than being left holding the port.
+func workerAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package http
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// listenReusePort is only supported on Linux.
+func listenReusePort(addr string) (net.Listener, error) {
+	return nil, errors.New("prefork: SO_REUSEPORT is not supported on this platform")
+}
+
+// workerAttr is how Prefork starts workers, which is never reached as
+// listenReusePort always fails.
+func workerAttr() *syscall.SysProcAttr {
+	return nil
+}
@@ -3,11 +3,17 @@ package http
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,6 +30,30 @@ var statusTitles = map[int]string{
 	202: "Accepted",
 	203: "Non-Authoritative Information",
 	204: "No Content",
+	206: "Partial Content",
+	301: "Moved Permanently",
+	302: "Found",
+	303: "See Other",
+	304: "Not Modified",
+	307: "Temporary Redirect",
+	308: "Permanent Redirect",
+	400: "Bad Request",
+	401: "Unauthorized",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	408: "Request Timeout",
+	409: "Conflict",
+	412: "Precondition Failed",
+	413: "Payload Too Large",
+	415: "Unsupported Media Type",
+	422: "Unprocessable Entity",
+	429: "Too Many Requests",
+	431: "Request Header Fields Too Large",
+	500: "Internal Server Error",
+	502: "Bad Gateway",
+	503: "Service Unavailable",
+	504: "Gateway Timeout",
 	// TODO: More status codes
 }
 
@@ -34,26 +64,119 @@ type Handler interface {
 	ServeHTTP(*Response, *Request)
 }
 
+// HandlerFunc allows an ordinary function to be used as a Handler.
+type HandlerFunc func(*Response, *Request)
+
+// ServeHTTP calls f(res, req).
+func (f HandlerFunc) ServeHTTP(res *Response, req *Request) {
+	f(res, req)
+}
+
 // Response is used to construct a HTTP response.
+//
+// The body is buffered so that Content-Length can be sent ahead of it. Once
+// more than a buffer's worth has been written, or the handler calls Flush,
+// the response switches to streaming: the headers are sent and the body
+// follows in chunks (see Flush).
 type Response struct {
 	Status  int
-	Headers map[string]string
+	Headers Header
+
+	// Body is the body of a response received by a Client, which must be
+	// closed once it has been read. Handlers write the body with Write
+	// instead.
+	Body io.ReadCloser
 
 	proto string
 	buf   bytes.Buffer
+
+	// w is where the response is streamed to. It is nil for responses that
+	// can only be buffered, such as those captured by middleware.
+	w io.Writer
+	// streaming is set once the headers have been sent. chunked is set if the
+	// body is being sent with chunked transfer encoding, and closeAfter if the
+	// end of the body has to be marked by closing the connection instead.
+	streaming  bool
+	chunked    bool
+	closeAfter bool
+	// failed is set if the headers of a streamed response could not be sent,
+	// after which nothing more is written.
+	failed bool
+
+	// Recorded as the handler writes so that middleware can inspect the
+	// response once the handler returns.
+	written    int
+	firstWrite time.Time
+
+	// limit caps the number of bytes that can be buffered, zero meaning no
+	// limit. overflow is set once a Write has been refused because of it.
+	limit    int
+	overflow bool
+
+	// problem renders errors from WriteError as problem details.
+	problem bool
+	// head is set for responses to HEAD requests, whose body is dropped
+	// rather than sent. The headers still describe it.
+	head bool
 }
 
+// errResponseTooLarge is returned by Response.Write when the connection's
+// memory budget does not allow any more of the body to be buffered.
+var errResponseTooLarge = errors.New("response exceeds connection memory budget")
+
 // Write writes data to a buffer which is later flushed to the network
-// connection.
+// connection. If the buffer would grow too large the response is streamed
+// instead.
 func (res *Response) Write(b []byte) (int, error) {
-	return res.buf.Write(b)
+	if res.firstWrite.IsZero() {
+		res.firstWrite = time.Now()
+	}
+
+	if res.buf.Len()+len(b) > res.bufferLimit() {
+		if res.w == nil {
+			res.overflow = true
+			return 0, errResponseTooLarge
+		}
+
+		// Send what is buffered and then b itself rather than holding on to it.
+		if err := res.Flush(); err != nil {
+			return 0, err
+		}
+		n, err := res.writeBody(b)
+		res.written += n
+		return n, err
+	}
+
+	n, err := res.buf.Write(b)
+	res.written += n
+	return n, err
+}
+
+// Written returns the number of body bytes written to the response so far.
+func (res *Response) Written() int {
+	return res.written
+}
+
+// FirstWrite returns the time of the first call to Write, or the zero time if
+// nothing has been written.
+func (res *Response) FirstWrite() time.Time {
+	return res.firstWrite
 }
 
 // writeTo writes an HTTP response with headers and buffered body to a writer.
+// For a response that is already streaming it sends the rest of the body and
+// marks its end.
 func (res *Response) writeTo(w io.Writer) error {
+	if res.streaming {
+		return res.finish()
+	}
+
 	if err := res.writeHeadersTo(w); err != nil {
 		return err
 	}
+	if res.head {
+		return nil
+	}
 
 	if _, err := res.buf.WriteTo(w); err != nil {
 		return err
@@ -69,37 +192,114 @@ func (res *Response) writeHeadersTo(w io.Writer) error {
 		return fmt.Errorf("unsupported status code: %v", res.Status)
 	}
 
-	res.Headers["Date"] = time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT")
-	res.Headers["Content-Length"] = strconv.Itoa(res.buf.Len())
+	res.Headers.Set("Date", time.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05 GMT"))
+	// The length of a streamed body is not known up front.
+	if !res.streaming {
+		res.Headers.Set("Content-Length", strconv.Itoa(res.buf.Len()))
+	}
 
+	// The status line, headers and blank line go out in a single write.
 	// https://www.w3.org/Protocols/rfc2616/rfc2616-sec6.html
-	headers := fmt.Sprintf("%s %v %s\r\n", res.proto, res.Status, statusText)
-	for k, v := range res.Headers {
-		headers += fmt.Sprintf("%s: %s\r\n", k, v)
-	}
-	headers += "\r\n"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %v %s\r\n", res.proto, res.Status, statusText)
+	res.Headers.writeTo(&b)
+	b.WriteString("\r\n")
 
-	if _, err := w.Write([]byte(headers)); err != nil {
+	if _, err := w.Write(b.Bytes()); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// captureResponse creates a Response for middleware that needs the whole body
+// before any of it is sent, such as to digest or store it. The capture is
+// always buffered, within the same memory budget as res, and is sent on with
+// copyResponse.
+func captureResponse(res *Response) *Response {
+	return &Response{
+		Status:  res.Status,
+		Headers: make(Header),
+		proto:   res.proto,
+		limit:   res.limit,
+		problem: res.problem,
+	}
+}
+
+// DefaultMaxBodyBytes is how much of a request body middleware that needs the
+// whole body up front reads unless told otherwise.
+const DefaultMaxBodyBytes = 1 << 20
+
+// errBodyTooLarge is returned by readBody for bodies over its limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBody reads the whole of a request body, failing with errBodyTooLarge
+// rather than reading more than max bytes. If max is zero,
+// DefaultMaxBodyBytes is used.
+func readBody(r io.Reader, max int64) ([]byte, error) {
+	if max == 0 {
+		max = DefaultMaxBodyBytes
+	}
+	btys, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err == nil && int64(len(btys)) > max {
+		return nil, errBodyTooLarge
+	}
+	return btys, err
+}
+
+// copyResponse copies a captured response into res. src is left intact so it
+// can be copied more than once.
+func copyResponse(res, src *Response) {
+	res.Status = src.Status
+	for k, v := range src.Headers.clone() {
+		res.Headers[k] = v
+	}
+	if src.overflow {
+		res.overflow = true
+		return
+	}
+	res.Write(src.buf.Bytes())
+}
+
 // Request represents a HTTP request sent to a server.
 type Request struct {
 	Method  string
 	URI     string
 	Proto   string
-	Headers map[string]string
+	Headers Header
+
+	// URL is URI parsed, with the scheme set to "https" for requests received
+	// over TLS and "http" otherwise, and the host taken from the host header
+	// unless URI is in absolute form. Query holds the parsed query string.
+	URL   *url.URL
+	Query url.Values
+
+	// TLS describes the connection for requests received over TLS, and is nil
+	// otherwise.
+	TLS *tls.ConnectionState
 
 	Body io.Reader
+
+	// RawRequestLine and RawHeaders hold the request line and header block
+	// exactly as they were received, line endings and all. RawHeaders ends
+	// with the empty line that terminates the headers. They are useful when
+	// the original bytes matter, such as for verifying signatures or forensic
+	// logging.
+	RawRequestLine string
+	RawHeaders     []byte
+
+	// Params holds the path parameters matched by a ServeMux, keyed by name
+	// without the leading ':' or '*'.
+	Params map[string]string
+
+	// headerBytes is the length of the request line and headers.
+	headerBytes int
 }
 
 // parseConnection determines whether a connection should be kept alive and
 // whether the connection header should be echoed in the response.
 func (req *Request) parseConnection() (bool, bool) {
-	conn := strings.ToLower(req.Headers["connection"])
+	conn := strings.ToLower(req.Headers.Get("Connection"))
 
 	switch req.Proto {
 	case http10:
@@ -107,9 +307,11 @@ func (req *Request) parseConnection() (bool, bool) {
 			return true, true
 		}
 	case http11:
+		// HTTP/1.1 connections are persistent unless the client says otherwise.
 		if conn == "close" {
 			return false, true
 		}
+		return true, false
 	}
 
 	return false, false
@@ -118,7 +320,13 @@ func (req *Request) parseConnection() (bool, bool) {
 // httpConn handles persistent HTTP connections.
 type httpConn struct {
 	netConn net.Conn
-	handler Handler
+	server  *Server
+
+	// tlsConn is the underlying connection if it is over TLS.
+	tlsConn *tls.Conn
+
+	// state is the connection's connState, accessed atomically.
+	state int32
 }
 
 // serve reads and responds to one or many HTTP requests off of a single
@@ -128,101 +336,454 @@ func (hc *httpConn) serve() {
 
 	buf := bufio.NewReader(hc.netConn)
 
-	for {
-		req, err := readRequest(buf)
+	for first := true; ; first = false {
+		if !hc.awaitRequest(buf, first) {
+			return
+		}
+
+		req, err := readRequest(buf, hc.server.MaxConnBytes)
+		if err == io.EOF {
+			// The client hung up between requests.
+			return
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			hc.writeError(408, "timed out reading request")
+			return
+		}
+		if err == errHeadersTooLarge {
+			hc.writeError(431, "request headers too large")
+			return
+		}
 		if err != nil {
-			const bad = "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n"
-			hc.netConn.Write([]byte(bad))
+			hc.writeError(400, err.Error())
 			return
 		}
+		hc.server.stats.totalRequests.Add(1)
+
+		if hc.tlsConn != nil {
+			state := hc.tlsConn.ConnectionState()
+			req.TLS = &state
+			req.URL.Scheme = "https"
+		}
 
 		res := Response{
 			Status:  200,
-			Headers: make(map[string]string),
+			Headers: make(Header),
 			proto:   req.Proto,
+			problem: hc.server.ProblemJSON,
+			head:    req.Method == "HEAD",
+			w:       hc.netConn,
+		}
+
+		hc.setServerHeaders(&res)
+
+		// Whatever the headers did not use of the budget is left for buffering
+		// the response body.
+		if max := hc.server.MaxConnBytes; max > 0 {
+			res.limit = max - req.headerBytes
 		}
 
 		// Determine if connection should be closed after request.
 		keepalive, echo := req.parseConnection()
 		if echo {
-			res.Headers["Connection"] = req.Headers["connection"]
+			res.Headers.Set("Connection", req.Headers.Get("Connection"))
+		}
+
+		if !hc.server.acquireHandler() {
+			hc.writeError(503, "server is busy")
+			return
+		}
+		hc.server.stats.activeConns.Add(1)
+		hc.server.Handler.ServeHTTP(&res, req)
+		hc.server.releaseHandler()
+
+		// The next request starts where this one's body ends, so whatever the
+		// handler left unread has to be skipped over first.
+		if keepalive && !drainBody(req) {
+			keepalive = false
+			if !res.streaming {
+				res.Headers.Set("Connection", "close")
+			}
 		}
 
-		hc.handler.ServeHTTP(&res, req)
+		if res.overflow {
+			hc.server.stats.activeConns.Add(-1)
+			// Once part of the response has gone out all that can be done is
+			// to cut it short.
+			if !res.streaming {
+				hc.writeError(500, "response too large")
+			}
+			return
+		}
 
-		if err := res.writeTo(hc.netConn); err != nil {
+		// Let the client know not to send another request if it is going to be
+		// turned away.
+		if hc.server.shuttingDown() {
+			keepalive = false
+			if !res.streaming {
+				res.Headers.Set("Connection", "close")
+			}
+		}
+
+		err = res.writeTo(hc.netConn)
+		hc.server.stats.activeConns.Add(-1)
+		hc.server.stats.response(res.Status)
+		if err != nil {
 			return
 		}
 
-		if !keepalive {
+		if !keepalive || res.closeAfter {
 			return
 		}
 	}
 }
 
+// awaitRequest waits for the next request to start arriving and then sets the
+// deadlines for reading it and writing the response. The wait for the first
+// request counts towards its ReadTimeout, while later requests are waited on
+// for the IdleTimeout. It reports false if the connection should be closed
+// instead, because the client went away, timed out or the Server is shutting
+// down.
+func (hc *httpConn) awaitRequest(buf *bufio.Reader, first bool) bool {
+	s := hc.server
+
+	hc.setState(connIdle)
+	if s.shuttingDown() {
+		return false
+	}
+
+	wait := s.IdleTimeout
+	if first || wait == 0 {
+		wait = s.ReadTimeout
+	}
+	hc.netConn.SetReadDeadline(deadline(wait))
+	if _, err := buf.Peek(1); err != nil {
+		return false
+	}
+
+	if !s.markActive(hc) {
+		return false
+	}
+	if !first {
+		hc.netConn.SetReadDeadline(deadline(s.ReadTimeout))
+	}
+	hc.netConn.SetWriteDeadline(deadline(s.WriteTimeout))
+	return true
+}
+
+// deadline returns the time d from now, or no deadline if d is zero.
+func deadline(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
+// maxDrain is the most unread request body that will be skipped over in order
+// to keep a connection open. Past that it is cheaper to close the connection.
+const maxDrain = 256 << 10
+
+// drainBody discards what is left of a request body, reporting whether it all
+// was.
+func drainBody(req *Request) bool {
+	n, err := io.CopyN(ioutil.Discard, req.Body, maxDrain+1)
+	return err == io.EOF && n <= maxDrain
+}
+
+// writeError responds with an error generated by the server itself and tells
+// the client that the connection is about to be closed.
+func (hc *httpConn) writeError(status int, detail string) {
+	res := Response{
+		Headers: Header{"Connection": {"close"}},
+		proto:   http11,
+		problem: hc.server.ProblemJSON,
+	}
+	hc.setServerHeaders(&res)
+	res.WriteError(status, detail)
+	res.writeTo(hc.netConn)
+	hc.server.stats.response(status)
+}
+
+// setServerHeaders adds the headers that the Server is configured to send on
+// every response.
+func (hc *httpConn) setServerHeaders(res *Response) {
+	if hc.server.ServerHeader != "" {
+		res.Headers.Set("Server", hc.server.ServerHeader)
+	}
+	if hc.server.altSvc != "" {
+		res.Headers.Set("Alt-Svc", hc.server.altSvc)
+	}
+}
+
 // Server wraps a Handler and manages a network listener.
 type Server struct {
 	Handler Handler
+
+	// AcceptFilter, if set, is called with each accepted connection before any
+	// HTTP parsing takes place. It may return a wrapped connection to serve in
+	// its place, or an error to close the connection without responding.
+	AcceptFilter func(net.Conn) (net.Conn, error)
+
+	// MaxConnBytes, if non-zero, caps the bytes a connection may buffer for a
+	// single request: the request line and headers plus the buffered response
+	// body. Oversized headers are rejected with 431. Response bodies that
+	// outgrow the budget are streamed, except where middleware needs the whole
+	// body up front, in which case the response is replaced by a 500 and the
+	// connection is closed. Request bodies are streamed to the handler and so
+	// do not count towards the budget.
+	MaxConnBytes int
+
+	// ServerHeader is sent as the Server header on every response, including
+	// errors generated by the Server itself. Handlers may override it. When
+	// empty no Server header is sent.
+	ServerHeader string
+
+	// MaxHandlers, if non-zero, limits how many requests are handled at once
+	// across all connections. Requests beyond that wait in a queue of up to
+	// MaxQueue requests for at most QueueTimeout (zero meaning no timeout).
+	// Requests that do not fit in the queue, or time out waiting, get a 503
+	// and are disconnected.
+	MaxHandlers  int
+	MaxQueue     int
+	QueueTimeout time.Duration
+
+	// ReadRate and WriteRate, if non-zero, limit each connection to that many
+	// bytes per second in each direction so that bulk transfers cannot starve
+	// other connections.
+	ReadRate  int
+	WriteRate int
+
+	// AltSvc lists alternative services, such as an HTTP/3 endpoint, that are
+	// advertised with an Alt-Svc header on every response.
+	AltSvc []AltService
+
+	// ProblemJSON renders errors generated by the Server and this package's
+	// handlers as RFC 9457 application/problem+json documents.
+	ProblemJSON bool
+
+	// ReadTimeout, if non-zero, limits how long reading a request may take,
+	// from when the connection is accepted or the request begins to arrive
+	// until the handler has read the body. Requests whose headers take longer
+	// get a 408. WriteTimeout limits how long writing the response may take,
+	// from when the request begins to arrive. IdleTimeout limits how long a
+	// persistent connection is left open waiting for the next request,
+	// defaulting to ReadTimeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// TLSConfig, if set, is the TLS configuration used by ServeTLS. It is
+	// copied rather than modified.
+	TLSConfig *tls.Config
+
+	stats serverStats
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	conns      map[*httpConn]struct{}
+	inShutdown int32
+
+	initOnce     sync.Once
+	altSvc       string
+	handlerSlots chan struct{}
+	queued       int32
+}
+
+// init sets up the Server's internal state on first use so that the zero
+// value is ready to serve.
+func (s *Server) init() {
+	s.initOnce.Do(func() {
+		if s.MaxHandlers > 0 {
+			s.handlerSlots = make(chan struct{}, s.MaxHandlers)
+		}
+		s.altSvc = formatAltSvc(s.AltSvc)
+		s.stats.started.Store(time.Now().UnixNano())
+	})
+}
+
+// acquireHandler waits for a free handler slot, reporting false if the queue
+// is full or the wait timed out.
+func (s *Server) acquireHandler() bool {
+	if s.handlerSlots == nil {
+		return true
+	}
+
+	// Skip the queue if there is a slot free right now.
+	select {
+	case s.handlerSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if atomic.AddInt32(&s.queued, 1) > int32(s.MaxQueue) {
+		atomic.AddInt32(&s.queued, -1)
+		return false
+	}
+	defer atomic.AddInt32(&s.queued, -1)
+
+	var timeout <-chan time.Time
+	if s.QueueTimeout > 0 {
+		timer := time.NewTimer(s.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case s.handlerSlots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// releaseHandler frees a slot taken by acquireHandler.
+func (s *Server) releaseHandler() {
+	if s.handlerSlots != nil {
+		<-s.handlerSlots
+	}
 }
 
 // Serve accepts incoming HTTP connections and handles them in a new goroutine.
+// After Shutdown or Close it returns ErrServerClosed.
 func (s *Server) Serve(l net.Listener) error {
 	defer l.Close()
 
+	s.init()
+
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
 	for {
 		nc, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			return err
 		}
 
-		hc := httpConn{nc, s.Handler}
-
 		// Spawn off a goroutine so we can accept other connections.
-		go hc.serve()
+		go s.serveConn(nc)
 	}
 }
 
-// readRequest generates a Request object by parsing text from a bufio.Reader.
-func readRequest(buf *bufio.Reader) (*Request, error) {
-	req := Request{
-		Headers: make(map[string]string),
+// serveConn passes a connection through the AcceptFilter and then serves HTTP
+// on it. The filter runs here rather than in Serve so that a slow filter does
+// not hold up accepting other connections.
+func (s *Server) serveConn(nc net.Conn) {
+	// Check for TLS before the connection gets wrapped.
+	tlsConn, _ := nc.(*tls.Conn)
+
+	if s.AcceptFilter != nil {
+		fc, err := s.AcceptFilter(nc)
+		if err != nil || fc == nil {
+			nc.Close()
+			return
+		}
+		nc = fc
 	}
+	nc = throttle(nc, s.ReadRate, s.WriteRate)
+	nc = &countingConn{Conn: nc, stats: &s.stats}
 
-	// Read the HTTP request line (first line).
-	if ln0, err := readHTTPLine(buf); err == nil {
-		var ok bool
-		if req.Method, req.URI, req.Proto, ok = parseRequestLine(ln0); !ok {
-			return nil, fmt.Errorf("malformed request line: %q", ln0)
-		}
+	s.stats.openConns.Add(1)
+	defer s.stats.openConns.Add(-1)
+
+	hc := &httpConn{netConn: nc, server: s, tlsConn: tlsConn}
+	if !s.trackConn(hc, true) {
+		nc.Close()
+		return
 	}
+	defer s.trackConn(hc, false)
+
+	hc.serve()
+}
+
+// readRequest generates a Request object by parsing text from a bufio.Reader.
+// If limit is non-zero, requests whose request line and headers are longer
+// than limit fail with errHeadersTooLarge.
+func readRequest(buf *bufio.Reader, limit int) (*Request, error) {
+	p := newRequestParser(limit)
 
-	// Read each subsequent header.
+	// Feed the parser whatever is already buffered, only blocking for more
+	// input when the buffer is empty.
 	for {
-		ln, err := readHTTPLine(buf)
+		if buf.Buffered() == 0 {
+			if _, err := buf.Peek(1); err != nil {
+				return nil, err
+			}
+		}
+
+		b, _ := buf.Peek(buf.Buffered())
+		n, done, err := p.feed(b)
+		buf.Discard(n)
 		if err != nil {
 			return nil, err
 		}
 
-		if len(ln) == 0 {
+		if done {
 			break
 		}
+	}
+	req := p.req
+	req.headerBytes = p.size
 
-		if key, val, ok := parseHeaderLine(ln); ok {
-			req.Headers[key] = val
+	if err := req.parseURL(); err != nil {
+		return nil, err
+	}
+
+	// A chunked body carries its own framing.
+	if te, ok := req.Headers["Transfer-Encoding"]; ok {
+		if len(te) != 1 || strings.ToLower(te[0]) != "chunked" {
+			return nil, fmt.Errorf("unsupported transfer-encoding: %q", strings.Join(te, ", "))
+		}
+		// Allowing both would let us and an intermediary disagree on where
+		// the body ends.
+		if _, ok := req.Headers["Content-Length"]; ok {
+			return nil, errors.New("both transfer-encoding and content-length set")
 		}
+		req.Body = &chunkedReader{buf: buf, trailerLimit: limit}
+		return req, nil
 	}
 
 	// Limit the body to the number of bytes specified by Content-Length.
 	var cl int64
-	if str, ok := req.Headers["content-length"]; ok {
+	if v, ok := req.Headers["Content-Length"]; ok {
+		// ParseInt alone would accept a sign, and a negative length would
+		// leave the body to be read as the next request.
 		var err error
-		if cl, err = strconv.ParseInt(str, 10, 64); err != nil {
+		if strings.TrimLeft(v[0], "0123456789") != "" {
+			return nil, fmt.Errorf("invalid content-length: %q", v[0])
+		}
+		if cl, err = strconv.ParseInt(v[0], 10, 64); err != nil {
 			return nil, err
 		}
 	}
 	req.Body = &io.LimitedReader{R: buf, N: cl}
 
-	return &req, nil
+	return req, nil
+}
+
+// parseURL fills in URL and Query from URI, assuming the request was not
+// received over TLS.
+func (req *Request) parseURL() error {
+	u, err := url.ParseRequestURI(req.URI)
+	if err != nil {
+		return fmt.Errorf("malformed request uri: %q", req.URI)
+	}
+	u.Scheme = "http"
+	if u.Host == "" {
+		u.Host = req.Headers.Get("Host")
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return fmt.Errorf("malformed query string: %q", u.RawQuery)
+	}
+
+	req.URL, req.Query = u, query
+	return nil
 }
 
 // parseRequestLine attempts to parse the initial line of an HTTP request.
@@ -236,22 +797,30 @@ func parseRequestLine(ln string) (method, uri, proto string, ok bool) {
 }
 
 // parseHeaderLine attempts to parse a standard HTTP header, e.g.
-// "Content-Type: application/json".
+// "Content-Type: application/json". The field name must be a token with no
+// whitespace around it (RFC 9112 section 5.1); a "Content-Length : 5" that we
+// ignored but an intermediary honoured would let requests be smuggled.
 func parseHeaderLine(ln string) (key, val string, ok bool) {
 	s := strings.SplitN(ln, ":", 2)
-	if len(s) != 2 {
+	if len(s) != 2 || !isToken(s[0]) {
 		return
 	}
 
-	return strings.ToLower(s[0]), strings.TrimSpace(s[1]), true
+	return s[0], strings.TrimSpace(s[1]), true
 }
 
-// readHTTPLine reads up to a newline feed and strips off the trailing crlf.
-func readHTTPLine(buf *bufio.Reader) (string, error) {
-	ln, err := buf.ReadString('\n')
-	if err != nil {
-		return "", err
+// isToken reports whether s is a non-empty token (RFC 9110 section 5.6.2).
+func isToken(s string) bool {
+	if s == "" {
+		return false
 	}
-
-	return strings.TrimSuffix(ln, "\r\n"), nil
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
 }
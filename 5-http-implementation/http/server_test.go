@@ -1,12 +1,17 @@
 package http_test
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"net"
 	stdhttp "net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nstogner/learning-http/5-http-implementation/http"
 )
@@ -72,6 +77,311 @@ func TestServe(t *testing.T) {
 	}
 }
 
+func TestResponseCapture(t *testing.T) {
+	const resBody = "captured"
+
+	var (
+		status  int
+		written int
+		first   time.Time
+	)
+	h := http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		res.Status = 202
+		res.Write([]byte(resBody))
+	})
+	start := time.Now()
+	url := startServer(t, http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		h.ServeHTTP(res, req)
+		status, written, first = res.Status, res.Written(), res.FirstWrite()
+	}))
+
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+
+	if status != 202 {
+		t.Fatalf("expected captured status 202, got: %v", status)
+	}
+	if exp := len(resBody); written != exp {
+		t.Fatalf("expected %v bytes written, got: %v", exp, written)
+	}
+	if first.Before(start) {
+		t.Fatalf("expected first write after %v, got: %v", start, first)
+	}
+}
+
+func TestAcceptFilter(t *testing.T) {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	defer l.Close()
+
+	var reject int32
+	server := http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		AcceptFilter: func(c net.Conn) (net.Conn, error) {
+			if atomic.LoadInt32(&reject) == 1 {
+				return nil, errors.New("denied")
+			}
+			return c, nil
+		},
+	}
+	go server.Serve(l)
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal("unable to split host and port:", err)
+	}
+	client := stdhttp.Client{
+		Transport: &stdhttp.Transport{DisableKeepAlives: true},
+	}
+
+	resp, err := client.Get("http://localhost:" + port)
+	if err != nil {
+		t.Fatal("expected accepted connection to be served:", err)
+	}
+	resp.Body.Close()
+
+	atomic.StoreInt32(&reject, 1)
+	if _, err := client.Get("http://localhost:" + port); err == nil {
+		t.Fatal("expected rejected connection to fail")
+	}
+}
+
+func TestMaxConnBytes(t *testing.T) {
+	url := serveOn(t, &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			if req.URI == "/big" {
+				res.Write(bytes.Repeat([]byte("x"), 1024))
+			}
+		}),
+		MaxConnBytes: 512,
+	})
+	digestURL := serveOn(t, &http.Server{
+		Handler: &http.ContentDigest{
+			Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+				res.Write(bytes.Repeat([]byte("x"), 1024))
+			}),
+			Always: true,
+		},
+		MaxConnBytes: 512,
+	})
+
+	get := func(url, path string, header stdhttp.Header) int {
+		req, err := stdhttp.NewRequest("GET", url+path, nil)
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header = header
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := get(url, "/small", nil); code != 200 {
+		t.Fatalf("expected status code 200, got: %v", code)
+	}
+	if code := get(url, "/big", nil); code != 200 {
+		t.Fatalf("expected oversized response to be streamed with 200, got: %v", code)
+	}
+	if code := get(digestURL, "/", nil); code != 500 {
+		t.Fatalf("expected oversized buffered response to give 500, got: %v", code)
+	}
+	huge := stdhttp.Header{"X-Huge": {strings.Repeat("y", 1024)}}
+	if code := get(url, "/small", huge); code != 431 {
+		t.Fatalf("expected oversized headers to give 431, got: %v", code)
+	}
+}
+
+func TestServerHeader(t *testing.T) {
+	const ident = "learning-http"
+
+	url := serveOn(t, &http.Server{
+		Handler:      http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		ServerHeader: ident,
+	})
+
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Server"); got != ident {
+		t.Fatalf("expected header 'Server' = %v, got: %v", ident, got)
+	}
+
+	// Errors generated by the server should carry the header too.
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("NOT HTTP\r\n\r\n"))
+	resp, err = stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected status code 400, got: %v", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Server"); got != ident {
+		t.Fatalf("expected header 'Server' = %v on error, got: %v", ident, got)
+	}
+}
+
+func TestHandlerQueue(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	url := serveOn(t, &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			started <- struct{}{}
+			<-release
+		}),
+		MaxHandlers:  1,
+		MaxQueue:     1,
+		QueueTimeout: time.Second,
+	})
+
+	codes := make(chan int, 2)
+	get := func() {
+		resp, err := stdhttp.Get(url)
+		if err != nil {
+			codes <- 0
+			return
+		}
+		resp.Body.Close()
+		codes <- resp.StatusCode
+	}
+
+	// The first request takes the only slot and the second waits in the queue.
+	go get()
+	<-started
+	go get()
+	time.Sleep(50 * time.Millisecond)
+
+	// With the queue full the third should be shed.
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Fatalf("expected status code 503, got: %v", resp.StatusCode)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != 200 {
+			t.Fatalf("expected queued requests to succeed, got: %v", code)
+		}
+	}
+}
+
+func TestAltSvc(t *testing.T) {
+	url := serveOn(t, &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		AltSvc: []http.AltService{
+			{Protocol: "h3", Authority: ":8443", MaxAge: time.Hour},
+			{Protocol: "h2", Authority: "alt.example.com:443"},
+		},
+	})
+
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+
+	if exp := `h3=":8443"; ma=3600, h2="alt.example.com:443"`; resp.Header.Get("Alt-Svc") != exp {
+		t.Fatalf("expected header 'Alt-Svc' = %v, got: %v", exp, resp.Header.Get("Alt-Svc"))
+	}
+}
+
+func TestStats(t *testing.T) {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	defer l.Close()
+
+	server := http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			if req.URI == "/missing" {
+				res.Status = 404
+			}
+			res.Write([]byte("hi"))
+		}),
+	}
+	go server.Serve(l)
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal("unable to split host and port:", err)
+	}
+	client := stdhttp.Client{
+		Transport: &stdhttp.Transport{DisableKeepAlives: true},
+	}
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get("http://localhost:" + port + path)
+		if err != nil {
+			t.Fatal("get failed:", err)
+		}
+		resp.Body.Close()
+	}
+
+	// Connections are closed in the background after the response is sent.
+	time.Sleep(50 * time.Millisecond)
+	st := server.Stats()
+
+	if st.TotalRequests != 3 {
+		t.Fatalf("expected 3 total requests, got: %v", st.TotalRequests)
+	}
+	if st.Responses[2] != 2 || st.Responses[4] != 1 {
+		t.Fatalf("expected 2 2xx and 1 4xx responses, got: %v", st.Responses)
+	}
+	if st.OpenConns != 0 || st.ActiveConns != 0 {
+		t.Fatalf("expected no open connections, got: %v open, %v active", st.OpenConns, st.ActiveConns)
+	}
+	if st.BytesIn == 0 || st.BytesOut == 0 {
+		t.Fatalf("expected bytes to be counted, got: %v in, %v out", st.BytesIn, st.BytesOut)
+	}
+	if st.Uptime <= 0 {
+		t.Fatalf("expected positive uptime, got: %v", st.Uptime)
+	}
+}
+
+// startServer serves h on any free port and returns the base URL that it can
+// be reached on. The listener is closed when the test finishes.
+func startServer(t *testing.T, h http.Handler) string {
+	return serveOn(t, &http.Server{
+		Handler: h,
+	})
+}
+
+// serveOn is like startServer but serves with a preconfigured Server.
+func serveOn(t *testing.T, server *http.Server) string {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go server.Serve(l)
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal("unable to split host and port:", err)
+	}
+	return "http://localhost:" + port
+}
+
 // testHandler records parsed request fields and sets predefined response
 // fields.
 type testHandler struct {
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNoSession is returned by a SessionStore when there is no live session for
+// an ID.
+var ErrNoSession = errors.New("session not found")
+
+// SessionStore persists session data by ID. Implementations must be safe for
+// concurrent use.
+type SessionStore interface {
+	// Get returns the data stored for id, or ErrNoSession if there is none or
+	// it has expired.
+	Get(id string) (map[string]string, error)
+	// Set stores data for id until ttl has elapsed.
+	Set(id string, data map[string]string, ttl time.Duration) error
+	// Delete removes the session for id if it exists.
+	Delete(id string) error
+	// GC removes every expired session.
+	GC() error
+}
+
+// session is a stored session along with its expiry.
+type session struct {
+	Data    map[string]string `json:"data"`
+	Expires time.Time         `json:"expires"`
+}
+
+// expired reports whether the session has passed its expiry.
+func (s session) expired() bool {
+	return time.Now().After(s.Expires)
+}
+
+// MemorySessionStore is a SessionStore that keeps sessions in memory. Sessions
+// are lost when the process exits.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// NewMemorySessionStore creates an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]session),
+	}
+}
+
+// Get satisfies the SessionStore interface.
+func (m *MemorySessionStore) Get(id string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.expired() {
+		return nil, ErrNoSession
+	}
+
+	return copySession(s.Data), nil
+}
+
+// Set satisfies the SessionStore interface.
+func (m *MemorySessionStore) Set(id string, data map[string]string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[id] = session{
+		Data:    copySession(data),
+		Expires: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// Delete satisfies the SessionStore interface.
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// GC satisfies the SessionStore interface.
+func (m *MemorySessionStore) GC() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.expired() {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// copySession copies session data so that callers cannot modify what is
+// stored.
+func copySession(data map[string]string) map[string]string {
+	c := make(map[string]string, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
+
+// FileSessionStore is a SessionStore that keeps each session as a JSON file in
+// Dir. Session IDs are used as file names, so only IDs made up of letters,
+// digits, '-' and '_', such as randomly generated hex or base64url IDs, can be
+// stored. Any other ID has no session.
+type FileSessionStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// Get satisfies the SessionStore interface.
+func (f *FileSessionStore) Get(id string) (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !validSessionID(id) {
+		return nil, ErrNoSession
+	}
+	s, err := f.read(f.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.expired() {
+		return nil, ErrNoSession
+	}
+
+	return s.Data, nil
+}
+
+// Set satisfies the SessionStore interface.
+func (f *FileSessionStore) Set(id string, data map[string]string, ttl time.Duration) error {
+	if !validSessionID(id) {
+		return fmt.Errorf("invalid session id: %q", id)
+	}
+	btys, err := json.Marshal(session{
+		Data:    data,
+		Expires: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Write to a temporary file first so that readers never see a partially
+	// written session.
+	tmp := f.path(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, btys, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path(id))
+}
+
+// Delete satisfies the SessionStore interface.
+func (f *FileSessionStore) Delete(id string) error {
+	if !validSessionID(id) {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(f.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// GC satisfies the SessionStore interface.
+func (f *FileSessionStore) GC() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(f.Dir, "*.session"))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		s, err := f.read(p)
+		if err != nil || s.expired() {
+			os.Remove(p)
+		}
+	}
+	return nil
+}
+
+// path returns the file that the session for id is stored in. id must be
+// valid.
+func (f *FileSessionStore) path(id string) string {
+	return filepath.Join(f.Dir, id+".session")
+}
+
+// validSessionID reports whether id can be used as a file name without it
+// naming some other file, as "../id" or "x/id" would.
+func validSessionID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// read loads a session file.
+func (f *FileSessionStore) read(path string) (session, error) {
+	var s session
+
+	btys, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(btys, &s)
+	return s, err
+}
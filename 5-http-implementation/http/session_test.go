@@ -0,0 +1,54 @@
+package http_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestSessionStores(t *testing.T) {
+	stores := map[string]http.SessionStore{
+		"memory": http.NewMemorySessionStore(),
+		"file":   &http.FileSessionStore{Dir: t.TempDir()},
+	}
+
+	for name, store := range stores {
+		if err := store.Set("live", map[string]string{"user": "42"}, time.Minute); err != nil {
+			t.Fatalf("%s: unable to set session: %v", name, err)
+		}
+		if err := store.Set("stale", map[string]string{"user": "7"}, -time.Second); err != nil {
+			t.Fatalf("%s: unable to set session: %v", name, err)
+		}
+
+		data, err := store.Get("live")
+		if err != nil {
+			t.Fatalf("%s: unable to get session: %v", name, err)
+		}
+		if exp := "42"; data["user"] != exp {
+			t.Fatalf("%s: expected user '%s', got: '%s'", name, exp, data["user"])
+		}
+
+		// IDs come from cookies, so one that looks like a path must not reach
+		// another session.
+		for _, id := range []string{"anything/live", "../live", "./live"} {
+			if _, err := store.Get(id); err != http.ErrNoSession {
+				t.Fatalf("%s: expected ErrNoSession for id '%s', got: %v", name, id, err)
+			}
+		}
+
+		if _, err := store.Get("stale"); err != http.ErrNoSession {
+			t.Fatalf("%s: expected ErrNoSession for expired session, got: %v", name, err)
+		}
+		if err := store.GC(); err != nil {
+			t.Fatalf("%s: unable to gc: %v", name, err)
+		}
+
+		if err := store.Delete("live"); err != nil {
+			t.Fatalf("%s: unable to delete session: %v", name, err)
+		}
+		if _, err := store.Get("live"); err != http.ErrNoSession {
+			t.Fatalf("%s: expected ErrNoSession after delete, got: %v", name, err)
+		}
+	}
+}
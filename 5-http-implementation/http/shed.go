@@ -0,0 +1,82 @@
+package http
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LoadShedder is admission control that wraps a Handler. Rather than letting
+// every request queue up behind an overloaded handler, it rejects the excess
+// straight away with 503 and a Retry-After header so that latency stays
+// reasonable for the requests that are admitted.
+//
+// A request is shed when MaxInFlight requests are already being handled, or
+// when the average handler latency has risen above LatencyTarget and at least
+// one request is already in flight.
+type LoadShedder struct {
+	Handler Handler
+
+	// MaxInFlight is the number of requests that may be in the handler at once.
+	// Zero means no limit.
+	MaxInFlight int
+	// LatencyTarget is the average latency above which load is shed. Zero
+	// disables latency based shedding.
+	LatencyTarget time.Duration
+	// RetryAfter is sent to shed clients, rounded up to whole seconds. It
+	// defaults to one second.
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	latency  time.Duration
+}
+
+// latencyWeight is how much each request moves the average latency.
+const latencyWeight = 0.1
+
+// ServeHTTP satisfies the Handler interface.
+func (ls *LoadShedder) ServeHTTP(res *Response, req *Request) {
+	if !ls.admit() {
+		retry := ls.RetryAfter
+		if retry <= 0 {
+			retry = time.Second
+		}
+		res.Headers.Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		res.WriteError(503, "server is overloaded")
+		return
+	}
+
+	start := time.Now()
+	ls.Handler.ServeHTTP(res, req)
+	ls.done(time.Since(start))
+}
+
+// admit reports whether a request may be handled, counting it as in flight if
+// so.
+func (ls *LoadShedder) admit() bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.MaxInFlight > 0 && ls.inFlight >= ls.MaxInFlight {
+		return false
+	}
+	// Always admit a request when nothing else is running so that the average
+	// latency keeps being updated and can recover.
+	if ls.LatencyTarget > 0 && ls.latency > ls.LatencyTarget && ls.inFlight > 0 {
+		return false
+	}
+
+	ls.inFlight++
+	return true
+}
+
+// done records that an admitted request took d to handle.
+func (ls *LoadShedder) done(d time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.inFlight--
+	ls.latency += time.Duration(latencyWeight * float64(d-ls.latency))
+}
@@ -0,0 +1,57 @@
+package http_test
+
+import (
+	stdhttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestLoadShedder(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	url := startServer(t, &http.LoadShedder{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			if req.URI == "/slow" {
+				close(started)
+				<-release
+			}
+		}),
+		MaxInFlight: 1,
+		RetryAfter:  2 * time.Second,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := stdhttp.Get(url + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	resp, err := stdhttp.Get(url + "/fast")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Fatalf("expected status code 503, got: %v", resp.StatusCode)
+	}
+	if exp := "2"; resp.Header.Get("Retry-After") != exp {
+		t.Fatalf("expected header 'Retry-After' = %v, got: %v", exp, resp.Header.Get("Retry-After"))
+	}
+
+	close(release)
+	<-done
+
+	resp, err = stdhttp.Get(url + "/fast")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code 200 once load has dropped, got: %v", resp.StatusCode)
+	}
+}
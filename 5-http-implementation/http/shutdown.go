@@ -0,0 +1,169 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve once Shutdown or Close has been called.
+var ErrServerClosed = errors.New("http: server closed")
+
+// shutdownPollInterval is how often Shutdown checks whether the last requests
+// have finished.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// connState is whether a connection is waiting for a request or handling one.
+type connState int32
+
+const (
+	connIdle connState = iota
+	connActive
+)
+
+// setState records whether hc is handling a request, which decides whether
+// Shutdown may close it.
+func (hc *httpConn) setState(state connState) {
+	atomic.StoreInt32(&hc.state, int32(state))
+}
+
+// markActive records that hc has started on a request. It reports false if
+// hc has already been closed by Shutdown, which checks for idle connections
+// under the same lock, so that a connection is never closed once a request has
+// started arriving on it.
+func (s *Server) markActive(hc *httpConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.conns[hc]; !ok {
+		return false
+	}
+	hc.setState(connActive)
+	return true
+}
+
+// idle reports whether hc is between requests.
+func (hc *httpConn) idle() bool {
+	return connState(atomic.LoadInt32(&hc.state)) == connIdle
+}
+
+// Shutdown stops the Server without interrupting requests in flight. It closes
+// every listener, then closes connections as soon as they are idle, returning
+// once none are left. Responses sent while shutting down tell the client that
+// the connection is being closed.
+//
+// If ctx is done first Shutdown gives up and returns its error, leaving the
+// remaining connections open; Close can be used to cut them off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	s.mu.Lock()
+	err := s.closeListeners()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the Server immediately, closing every listener and connection
+// including those in the middle of a request.
+func (s *Server) Close() error {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.closeListeners()
+	for hc := range s.conns {
+		hc.netConn.Close()
+		delete(s.conns, hc)
+	}
+	return err
+}
+
+// shuttingDown reports whether Shutdown or Close has been called.
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) == 1
+}
+
+// trackListener adds or removes a listener from those closed on shutdown. It
+// reports false if the Server has already been shut down.
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.shuttingDown() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// trackConn adds or removes a connection from those waited on by Shutdown. It
+// reports false if the Server has already been shut down.
+func (s *Server) trackConn(hc *httpConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.conns, hc)
+		return true
+	}
+	if s.shuttingDown() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*httpConn]struct{})
+	}
+	s.conns[hc] = struct{}{}
+	return true
+}
+
+// closeListeners closes every tracked listener. s.mu must be held.
+func (s *Server) closeListeners() error {
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(s.listeners, l)
+	}
+	return err
+}
+
+// closeIdleConns closes connections that are between requests and reports
+// whether that was all of them.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quiet := true
+	for hc := range s.conns {
+		if !hc.idle() {
+			quiet = false
+			continue
+		}
+		hc.netConn.Close()
+		delete(s.conns, hc)
+	}
+	return quiet
+}
@@ -0,0 +1,157 @@
+package http_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+// listen starts serving on a new listener, returning its address and a channel
+// that receives what Serve returns.
+func listen(t *testing.T, server *http.Server) (string, <-chan error) {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(l) }()
+	return l.Addr().String(), done
+}
+
+func TestShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			if req.URI == "/slow" {
+				close(started)
+				<-release
+			}
+			res.Write([]byte("done"))
+		}),
+	}
+	addr, served := listen(t, server)
+
+	// An idle keep-alive connection should not hold up the shutdown.
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer idle.Close()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := stdhttp.Get("http://" + addr + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- server.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatal("expected shutdown to wait for in-flight request, got:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Fatal("expected listener to be closed during shutdown")
+	}
+
+	close(release)
+	if r := <-slow; r.err != nil || r.body != "done" {
+		t.Fatalf("expected in-flight request to complete, got: '%s' %v", r.body, r.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatal("expected shutdown to succeed, got:", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("expected serve to return %v, got: %v", http.ErrServerClosed, err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			close(started)
+			time.Sleep(time.Second)
+		}),
+	}
+	addr, _ := listen(t, server)
+
+	go stdhttp.Get("http://" + addr)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected shutdown to give up with %v, got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	addr, _ := listen(t, &http.Server{
+		Handler:     http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		ReadTimeout: 50 * time.Millisecond,
+		IdleTimeout: 50 * time.Millisecond,
+	})
+
+	// A request whose headers never finish arriving.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: a.example\r\n")); err != nil {
+		t.Fatal("unable to write request:", err)
+	}
+	resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 408 {
+		t.Fatalf("expected status code 408, got: %v", resp.StatusCode)
+	}
+
+	// A keep-alive connection that is left idle.
+	conn, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("unable to dial:", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal("unable to write request:", err)
+	}
+	buf := bufio.NewReader(conn)
+	resp, err = stdhttp.ReadResponse(buf, nil)
+	if err != nil {
+		t.Fatal("unable to read response:", err)
+	}
+	resp.Body.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := buf.ReadByte(); err == nil {
+		t.Fatal("expected idle connection to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("expected idle connection to be closed by the server, timed out waiting")
+	}
+}
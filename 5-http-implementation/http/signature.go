@@ -0,0 +1,379 @@
+package http
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureKey creates and checks HTTP message signatures (RFC 9421) for a
+// single algorithm.
+type SignatureKey interface {
+	// Alg is the algorithm name sent in the alg parameter.
+	Alg() string
+	Sign(base []byte) ([]byte, error)
+	Verify(base, sig []byte) error
+}
+
+// signatureSkew is how far in the future a signature's created time may be,
+// to allow for the signer's clock running ahead of ours.
+const signatureSkew = time.Minute
+
+// errBadSignature is returned when a signature does not match.
+var errBadSignature = errors.New("signature does not match")
+
+// HMACKey is a shared secret used with hmac-sha256.
+type HMACKey []byte
+
+// Alg satisfies the SignatureKey interface.
+func (k HMACKey) Alg() string { return "hmac-sha256" }
+
+// Sign satisfies the SignatureKey interface.
+func (k HMACKey) Sign(base []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(base)
+	return mac.Sum(nil), nil
+}
+
+// Verify satisfies the SignatureKey interface.
+func (k HMACKey) Verify(base, sig []byte) error {
+	exp, _ := k.Sign(base)
+	if !hmac.Equal(sig, exp) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// Ed25519Key is an ed25519 key pair. Only Public is needed to verify and only
+// Private is needed to sign.
+type Ed25519Key struct {
+	Public  ed25519.PublicKey
+	Private ed25519.PrivateKey
+}
+
+// Alg satisfies the SignatureKey interface.
+func (k Ed25519Key) Alg() string { return "ed25519" }
+
+// Sign satisfies the SignatureKey interface.
+func (k Ed25519Key) Sign(base []byte) ([]byte, error) {
+	if len(k.Private) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519: no private key")
+	}
+	return ed25519.Sign(k.Private, base), nil
+}
+
+// Verify satisfies the SignatureKey interface.
+func (k Ed25519Key) Verify(base, sig []byte) error {
+	if len(k.Public) != ed25519.PublicKeySize || !ed25519.Verify(k.Public, base, sig) {
+		return errBadSignature
+	}
+	return nil
+}
+
+// SignRequest signs the given components of req with key and adds the
+// Signature-Input and Signature headers under label. Components are either
+// derived components ("@method", "@authority", "@path", "@query",
+// "@request-target") or lowercase header names.
+func SignRequest(req *Request, label, keyid string, key SignatureKey, components []string) error {
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	params := fmt.Sprintf("(%s);created=%d;keyid=%q;alg=%q",
+		strings.Join(quoted, " "), time.Now().Unix(), keyid, key.Alg())
+
+	base, err := signatureBase(req, components, params)
+	if err != nil {
+		return err
+	}
+	sig, err := key.Sign(base)
+	if err != nil {
+		return err
+	}
+
+	req.Headers.Set("signature-input", label+"="+params)
+	req.Headers.Set("signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// SignatureVerifier is middleware that only lets through requests carrying a
+// valid HTTP message signature. Requests that are unsigned, or whose signature
+// is invalid, are rejected with 401, as are signatures created in the future
+// or past their expires time.
+type SignatureVerifier struct {
+	Handler Handler
+
+	// Keys looks up the key for a keyid.
+	Keys func(keyid string) (SignatureKey, bool)
+	// Required lists components that a signature must cover to be accepted.
+	Required []string
+	// MaxAge, if non-zero, rejects signatures created longer ago than this.
+	MaxAge time.Duration
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (sv *SignatureVerifier) ServeHTTP(res *Response, req *Request) {
+	if err := sv.verify(req); err != nil {
+		res.WriteError(401, err.Error())
+		return
+	}
+
+	sv.Handler.ServeHTTP(res, req)
+}
+
+// verify succeeds if any one of the request's signatures is acceptable.
+func (sv *SignatureVerifier) verify(req *Request) error {
+	inputs, err := parseSignatureInput(strings.Join(req.Headers.Values("Signature-Input"), ", "))
+	if err != nil {
+		return err
+	}
+	sigs, err := parseByteDictionary(strings.Join(req.Headers.Values("Signature"), ", "))
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return errors.New("request is not signed")
+	}
+
+	err = errors.New("no matching signature")
+	for label, in := range inputs {
+		sig, ok := sigs[label]
+		if !ok {
+			continue
+		}
+		if err = sv.verifyOne(req, in, sig); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifyOne checks a single signature against its input.
+func (sv *SignatureVerifier) verifyOne(req *Request, in sigInput, sig []byte) error {
+	for _, r := range sv.Required {
+		if !in.covers(r) {
+			return fmt.Errorf("signature does not cover %q", r)
+		}
+	}
+
+	now := time.Now()
+	if in.created != 0 && time.Unix(in.created, 0).Sub(now) > signatureSkew {
+		return errors.New("signature was created in the future")
+	}
+	if in.expires != 0 && now.After(time.Unix(in.expires, 0)) {
+		return errors.New("signature has expired")
+	}
+	if sv.MaxAge > 0 {
+		if in.created == 0 {
+			return errors.New("signature has no created time")
+		}
+		if now.Sub(time.Unix(in.created, 0)) > sv.MaxAge {
+			return errors.New("signature has expired")
+		}
+	}
+
+	key, ok := sv.Keys(in.keyid)
+	if !ok {
+		return fmt.Errorf("unknown keyid: %q", in.keyid)
+	}
+	if in.alg != "" && in.alg != key.Alg() {
+		return fmt.Errorf("unexpected alg: %q", in.alg)
+	}
+
+	base, err := signatureBase(req, in.components, in.params)
+	if err != nil {
+		return err
+	}
+	return key.Verify(base, sig)
+}
+
+// signatureBase builds the signature base (RFC 9421 section 2.5) that is signed
+// for the given components. params is the serialized signature parameters.
+func signatureBase(req *Request, components []string, params string) ([]byte, error) {
+	path, query := req.URI, "?"
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+
+	var b strings.Builder
+	for _, c := range components {
+		var v string
+		switch c {
+		case "@method":
+			v = req.Method
+		case "@authority":
+			v = strings.ToLower(req.Headers.Get("Host"))
+		case "@path":
+			v = path
+		case "@query":
+			v = query
+		case "@request-target":
+			v = req.URI
+		default:
+			if strings.HasPrefix(c, "@") {
+				return nil, fmt.Errorf("unsupported component: %q", c)
+			}
+			// Repeated fields are combined as they would be by a proxy.
+			values := req.Headers.Values(c)
+			if values == nil {
+				return nil, fmt.Errorf("signed header is missing: %q", c)
+			}
+			v = strings.Join(values, ", ")
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, v)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", params)
+
+	return []byte(b.String()), nil
+}
+
+// sigInput is a parsed Signature-Input member.
+type sigInput struct {
+	components []string
+	// params is the member value exactly as it was sent, which is what gets
+	// signed as @signature-params.
+	params string
+
+	created int64
+	expires int64
+	keyid   string
+	alg     string
+}
+
+// covers reports whether the signature covers component c.
+func (in sigInput) covers(c string) bool {
+	for _, ic := range in.components {
+		if ic == c {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSignatureInput parses a Signature-Input dictionary such as:
+//
+//	sig1=("@method" "@path");created=1618884473;keyid="test-key"
+//
+// Component parameters are not supported.
+func parseSignatureInput(v string) (map[string]sigInput, error) {
+	inputs := make(map[string]sigInput)
+	malformed := fmt.Errorf("malformed signature-input: %q", v)
+
+	for v = strings.TrimLeft(v, " ,"); v != ""; v = strings.TrimLeft(v, " ,") {
+		eq := strings.IndexByte(v, '=')
+		if eq < 1 || len(v) < eq+2 || v[eq+1] != '(' {
+			return nil, malformed
+		}
+		label := v[:eq]
+		v = v[eq+1:]
+
+		var in sigInput
+		end := strings.IndexByte(v, ')')
+		if end < 0 {
+			return nil, malformed
+		}
+		for _, f := range strings.Fields(v[1:end]) {
+			c, err := strconv.Unquote(f)
+			if err != nil {
+				return nil, malformed
+			}
+			in.components = append(in.components, c)
+		}
+
+		// Walk the parameters to find where this member ends.
+		i := end + 1
+		for i < len(v) && v[i] == ';' {
+			eq := strings.IndexByte(v[i:], '=')
+			if eq < 0 {
+				return nil, malformed
+			}
+			key := v[i+1 : i+eq]
+			i += eq + 1
+
+			var val string
+			if i < len(v) && v[i] == '"' {
+				j := i + 1
+				for j < len(v) && v[j] != '"' {
+					if v[j] == '\\' {
+						j++
+					}
+					j++
+				}
+				if j >= len(v) {
+					return nil, malformed
+				}
+				var err error
+				if val, err = strconv.Unquote(v[i : j+1]); err != nil {
+					return nil, malformed
+				}
+				i = j + 1
+			} else {
+				j := i
+				for j < len(v) && v[j] != ';' && v[j] != ',' {
+					j++
+				}
+				val = v[i:j]
+				i = j
+			}
+
+			var err error
+			switch key {
+			case "created":
+				in.created, err = strconv.ParseInt(val, 10, 64)
+			case "expires":
+				in.expires, err = strconv.ParseInt(val, 10, 64)
+			case "keyid":
+				in.keyid = val
+			case "alg":
+				in.alg = val
+			}
+			if err != nil {
+				return nil, malformed
+			}
+		}
+
+		in.params = v[:i]
+		inputs[label] = in
+		v = v[i:]
+	}
+
+	return inputs, nil
+}
+
+// parseByteDictionary parses a structured field dictionary whose values are
+// all byte sequences, as used by the Signature and Content-Digest headers:
+//
+//	sig1=:MEUCIQDX...:, sig2=:cGxlYXNlIGRvbid0IGRlY29kZSB0aGlz:
+func parseByteDictionary(v string) (map[string][]byte, error) {
+	members := make(map[string][]byte)
+
+	for _, member := range strings.Split(v, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		eq := strings.IndexByte(member, '=')
+		if eq < 1 {
+			return nil, fmt.Errorf("malformed dictionary member: %q", member)
+		}
+		enc := member[eq+1:]
+		if len(enc) < 2 || enc[0] != ':' || enc[len(enc)-1] != ':' {
+			return nil, fmt.Errorf("malformed dictionary member: %q", member)
+		}
+
+		val, err := base64.StdEncoding.DecodeString(enc[1 : len(enc)-1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed dictionary member: %q", member)
+		}
+		members[member[:eq]] = val
+	}
+
+	return members, nil
+}
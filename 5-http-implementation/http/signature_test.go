@@ -0,0 +1,144 @@
+package http_test
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	stdhttp "net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("unable to generate key:", err)
+	}
+	keys := map[string]http.SignatureKey{
+		"shared": http.HMACKey("secret"),
+		"signer": http.Ed25519Key{Public: pub, Private: priv},
+	}
+
+	url := startServer(t, &http.SignatureVerifier{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {}),
+		Keys: func(keyid string) (http.SignatureKey, bool) {
+			k, ok := keys[keyid]
+			if ok {
+				// The verifier only needs the public half.
+				if ek, isEd := k.(http.Ed25519Key); isEd {
+					k = http.Ed25519Key{Public: ek.Public}
+				}
+			}
+			return k, ok
+		},
+		Required: []string{"@method", "@path"},
+		MaxAge:   time.Minute,
+	})
+	host := strings.TrimPrefix(url, "http://")
+
+	// send signs a request for signedURI but sends it to sentURI.
+	send := func(keyid string, components []string, signedURI, sentURI string) int {
+		signed := http.Request{
+			Method: "POST",
+			URI:    signedURI,
+			Headers: http.Header{
+				"Host":         {host},
+				"Content-Type": {"application/json"},
+			},
+		}
+		if err := http.SignRequest(&signed, "sig1", keyid, keys[keyid], components); err != nil {
+			t.Fatal("unable to sign request:", err)
+		}
+
+		req, err := stdhttp.NewRequest("POST", url+sentURI, nil)
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		for k, v := range signed.Headers {
+			if k != "Host" {
+				req.Header[k] = v
+			}
+		}
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	all := []string{"@method", "@authority", "@path", "@query", "content-type"}
+	cases := []struct {
+		name       string
+		keyid      string
+		components []string
+		sentURI    string
+		status     int
+	}{
+		{"hmac", "shared", all, "/pay?id=1", 200},
+		{"ed25519", "signer", all, "/pay?id=1", 200},
+		{"tampered query", "shared", all, "/pay?id=2", 401},
+		{"missing required", "shared", []string{"@method"}, "/pay?id=1", 401},
+	}
+	for _, c := range cases {
+		if code := send(c.keyid, c.components, "/pay?id=1", c.sentURI); code != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, code)
+		}
+	}
+
+	// sendParams signs "@method" and "@path" with the shared key by hand, so
+	// that the created and expires times can be chosen.
+	sendParams := func(params string) int {
+		params = `("@method" "@path")` + params + `;keyid="shared"`
+		mac := hmac.New(sha256.New, []byte("secret"))
+		fmt.Fprintf(mac, "\"@method\": POST\n\"@path\": /pay\n\"@signature-params\": %s", params)
+
+		req, err := stdhttp.NewRequest("POST", url+"/pay", nil)
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("Signature-Input", "sig1="+params)
+		req.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(mac.Sum(nil))+":")
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	now := time.Now().Unix()
+	timeCases := []struct {
+		name   string
+		params string
+		status int
+	}{
+		{"current", fmt.Sprintf(";created=%d", now), 200},
+		{"slight clock skew", fmt.Sprintf(";created=%d", now+10), 200},
+		{"created in the future", fmt.Sprintf(";created=%d", now+3600), 401},
+		{"too old", fmt.Sprintf(";created=%d", now-3600), 401},
+		{"not expired", fmt.Sprintf(";created=%d;expires=%d", now, now+30), 200},
+		{"expired", fmt.Sprintf(";created=%d;expires=%d", now-20, now-10), 401},
+		{"malformed expires", fmt.Sprintf(";created=%d;expires=soon", now), 401},
+	}
+	for _, c := range timeCases {
+		if code := sendParams(c.params); code != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, code)
+		}
+	}
+
+	resp, err := stdhttp.Post(url, "application/json", nil)
+	if err != nil {
+		t.Fatal("post failed:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 401 {
+		t.Fatalf("expected unsigned request to get 401, got: %v", resp.StatusCode)
+	}
+}
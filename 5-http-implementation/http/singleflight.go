@@ -0,0 +1,87 @@
+package http
+
+import (
+	"strings"
+	"sync"
+)
+
+// Coalesce wraps a Handler so that concurrent GET requests for the same host
+// and URI, made with the same credentials, share a single execution of h. The
+// first request runs the handler and every request that arrives while it is in
+// flight receives a copy of the same response.
+//
+// Requests are only treated as identical if their Authorization and Cookie
+// headers match too, so that one user never sees a response meant for
+// another. A response that sets a cookie, or that has a Vary header because it
+// depends on headers such as Accept, is never shared either: waiters run the
+// handler for themselves instead, as they do if it panics.
+func Coalesce(h Handler) Handler {
+	return &coalescer{
+		handler: h,
+		calls:   make(map[string]*call),
+	}
+}
+
+// call is a handler execution that other requests may be waiting on.
+type call struct {
+	done chan struct{}
+
+	// res is the captured response, which must not be read until done is
+	// closed. ok is set if the handler returned normally.
+	res *Response
+	ok  bool
+}
+
+type coalescer struct {
+	handler Handler
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (c *coalescer) ServeHTTP(res *Response, req *Request) {
+	// Only safe requests can be collapsed together.
+	if req.Method != "GET" {
+		c.handler.ServeHTTP(res, req)
+		return
+	}
+
+	key := strings.Join([]string{
+		req.Headers.Get("Host"),
+		req.URI,
+		strings.Join(req.Headers.Values("Authorization"), ", "),
+		strings.Join(req.Headers.Values("Cookie"), "; "),
+	}, "\x00")
+
+	c.mu.Lock()
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		if !cl.ok || cl.res.Headers["Set-Cookie"] != nil || cl.res.Headers.Get("Vary") != "" {
+			c.handler.ServeHTTP(res, req)
+			return
+		}
+		copyResponse(res, cl.res)
+		return
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	// Waiters must be released even if the handler panics.
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+
+	// Run the handler against a private Response so that the result can be
+	// handed to every waiter, not just the request that triggered it.
+	cl.res = captureResponse(res)
+	c.handler.ServeHTTP(cl.res, req)
+	cl.ok = true
+
+	copyResponse(res, cl.res)
+}
@@ -0,0 +1,163 @@
+package http_test
+
+import (
+	"io/ioutil"
+	stdhttp "net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestCoalesce(t *testing.T) {
+	const n = 5
+
+	var calls int32
+	release := make(chan struct{})
+	h := http.Coalesce(http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		res.Status = 202
+		res.Write([]byte("shared"))
+	}))
+	url := startServer(t, h)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := stdhttp.Get(url + "/expensive")
+			if err != nil {
+				t.Error("get failed:", err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != 202 {
+				t.Errorf("expected status code 202, got: %v", resp.StatusCode)
+			}
+			b, _ := ioutil.ReadAll(resp.Body)
+			bodies[i] = string(b)
+		}(i)
+	}
+
+	// Give every request a chance to join the in-flight call.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Fatalf("expected handler to run once, ran %v times", c)
+	}
+	for _, b := range bodies {
+		if b != "shared" {
+			t.Fatalf("expected body 'shared', got: '%s'", b)
+		}
+	}
+}
+
+func TestCoalesceNotShared(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := http.Coalesce(http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		switch req.URI {
+		case "/session":
+			res.Headers.Set("Set-Cookie", "session=secret")
+		case "/negotiated":
+			res.Headers.Set("Vary", "Accept")
+		}
+		res.Write([]byte(req.Headers.Get("Cookie")))
+	}))
+	url := startServer(t, h)
+
+	cases := []struct {
+		name    string
+		path    string
+		cookies []string
+	}{
+		{name: "different cookies", path: "/profile", cookies: []string{"user=1", "user=2", "user=3"}},
+		{name: "sets a cookie", path: "/session", cookies: []string{"", "", ""}},
+		{name: "varies", path: "/negotiated", cookies: []string{"", "", ""}},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&calls, 0)
+		release = make(chan struct{})
+
+		var wg sync.WaitGroup
+		bodies := make([]string, len(c.cookies))
+		for i, cookie := range c.cookies {
+			wg.Add(1)
+			go func(i int, cookie string) {
+				defer wg.Done()
+				req, _ := stdhttp.NewRequest("GET", url+c.path, nil)
+				if cookie != "" {
+					req.Header.Set("Cookie", cookie)
+				}
+				resp, err := stdhttp.DefaultClient.Do(req)
+				if err != nil {
+					t.Error("get failed:", err)
+					return
+				}
+				defer resp.Body.Close()
+				b, _ := ioutil.ReadAll(resp.Body)
+				bodies[i] = string(b)
+			}(i, cookie)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if n := atomic.LoadInt32(&calls); n != int32(len(c.cookies)) {
+			t.Fatalf("%s: expected handler to run %v times, ran %v times", c.name, len(c.cookies), n)
+		}
+		for i, b := range bodies {
+			if b != c.cookies[i] {
+				t.Fatalf("%s: expected body '%s', got: '%s'", c.name, c.cookies[i], b)
+			}
+		}
+	}
+}
+
+func TestCoalescePanic(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := http.Coalesce(http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+			panic("handler failed")
+		}
+		res.Write([]byte("retried"))
+	}))
+	serve := func() *http.Response {
+		res := &http.Response{Status: 200, Headers: http.Header{}}
+		h.ServeHTTP(res, &http.Request{Method: "GET", URI: "/", Headers: http.Header{}})
+		return res
+	}
+
+	go func() {
+		defer func() { recover() }()
+		serve()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan *http.Response)
+	go func() { done <- serve() }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected waiter to be released when the handler panicked")
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected waiter to run the handler itself, ran %v times", n)
+	}
+}
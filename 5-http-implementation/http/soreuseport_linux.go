@@ -0,0 +1,8 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package http
+
+// soReusePort is the value of SO_REUSEPORT, which the syscall package does not
+// define on Linux. It differs between architectures.
+const soReusePort = 0xf
@@ -0,0 +1,8 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package http
+
+// soReusePort is the value of SO_REUSEPORT on MIPS.
+const soReusePort = 0x200
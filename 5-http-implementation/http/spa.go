@@ -0,0 +1,68 @@
+package http
+
+import (
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+)
+
+// SPAHandler serves a single-page app. Requests for files that exist in FS are
+// served as static assets. Any other path is assumed to be a client-side route
+// and gets Index instead, marked no-cache so that new deploys are picked up.
+// Missing paths that look like assets (they have a file extension) still get
+// a 404 so that broken asset links are noticed rather than answered with HTML.
+type SPAHandler struct {
+	FS fs.FS
+
+	// Index is the app's entry point. It defaults to "index.html".
+	Index string
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (sh *SPAHandler) ServeHTTP(res *Response, req *Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		res.Headers.Set("Allow", "GET, HEAD")
+		res.WriteError(405, "")
+		return
+	}
+
+	p := req.URL.Path
+	// Cleaning a rooted path removes any ".." that would escape FS.
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+
+	if name != "" {
+		if info, err := fs.Stat(sh.FS, name); err == nil && !info.IsDir() {
+			sh.serveFile(res, req, name)
+			return
+		}
+		if path.Ext(name) != "" {
+			res.WriteError(404, "")
+			return
+		}
+	}
+
+	index := sh.Index
+	if index == "" {
+		index = "index.html"
+	}
+	res.Headers.Set("Cache-Control", "no-cache")
+	sh.serveFile(res, req, index)
+}
+
+// serveFile writes the named file to the response.
+func (sh *SPAHandler) serveFile(res *Response, req *Request, name string) {
+	btys, err := fs.ReadFile(sh.FS, name)
+	if err != nil {
+		res.WriteError(404, "")
+		return
+	}
+
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		res.Headers.Set("Content-Type", ct)
+	}
+	if req.Method == "HEAD" {
+		return
+	}
+	res.Write(btys)
+}
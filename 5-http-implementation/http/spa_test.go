@@ -0,0 +1,51 @@
+package http_test
+
+import (
+	"io/ioutil"
+	stdhttp "net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestSPAHandler(t *testing.T) {
+	url := startServer(t, &http.SPAHandler{
+		FS: fstest.MapFS{
+			"index.html":    {Data: []byte("<app>")},
+			"assets/app.js": {Data: []byte("run()")},
+		},
+	})
+
+	cases := []struct {
+		path         string
+		status       int
+		body         string
+		cacheControl string
+	}{
+		{"/assets/app.js", 200, "run()", ""},
+		{"/users/42?tab=posts", 200, "<app>", "no-cache"},
+		{"/", 200, "<app>", "no-cache"},
+		{"/assets/missing.js", 404, "", ""},
+		{"/../../etc/passwd", 200, "<app>", "no-cache"},
+	}
+
+	for _, c := range cases {
+		resp, err := stdhttp.Get(url + c.path)
+		if err != nil {
+			t.Fatalf("%s: get failed: %v", c.path, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.path, c.status, resp.StatusCode)
+		}
+		if string(body) != c.body {
+			t.Fatalf("%s: expected body '%s', got: '%s'", c.path, c.body, body)
+		}
+		if got := resp.Header.Get("Cache-Control"); got != c.cacheControl {
+			t.Fatalf("%s: expected header 'Cache-Control' = %v, got: %v", c.path, c.cacheControl, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// tlsRecordHandshake is the first byte of every TLS connection: the record
+// type of the handshake record that carries the ClientHello.
+const tlsRecordHandshake = 0x16
+
+// splitPeekTimeout is how long a new connection has to send its first byte
+// before it is dropped.
+const splitPeekTimeout = 10 * time.Second
+
+// splitHandoffTimeout is how long a routed connection waits to be accepted
+// before it is dropped.
+const splitHandoffTimeout = 10 * time.Second
+
+// SplitTLS separates the connections accepted from l according to whether they
+// start with a TLS handshake, so that HTTPS and plain HTTP can share a single
+// port. Connections on the first listener are still encrypted and are meant
+// to be wrapped with tls.NewListener before being served. Closing either
+// listener closes l.
+//
+// Both listeners must be served. A connection that has not been accepted ten
+// seconds after it arrived, as happens to every connection for a listener
+// nobody calls Accept on, is closed.
+func SplitTLS(l net.Listener) (tlsListener, plainListener net.Listener) {
+	sl := &splitListener{
+		l:     l,
+		tls:   make(chan net.Conn),
+		plain: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	go sl.accept()
+
+	return &subListener{sl, sl.tls}, &subListener{sl, sl.plain}
+}
+
+// splitListener accepts connections and hands them out to one of two
+// subListeners.
+type splitListener struct {
+	l          net.Listener
+	tls, plain chan net.Conn
+
+	// done is closed with err set once l stops accepting.
+	done     chan struct{}
+	err      error
+	doneOnce sync.Once
+}
+
+// accept runs the accept loop for both subListeners.
+func (sl *splitListener) accept() {
+	for {
+		c, err := sl.l.Accept()
+		if err != nil {
+			sl.doneOnce.Do(func() {
+				sl.err = err
+				close(sl.done)
+			})
+			return
+		}
+
+		// Peek in a new goroutine so that a client that never sends anything
+		// does not stop other connections from being accepted.
+		go sl.route(c)
+	}
+}
+
+// route peeks at the first byte of c and passes it on to the matching
+// listener.
+func (sl *splitListener) route(c net.Conn) {
+	pc := &peekedConn{Conn: c, r: bufio.NewReader(c)}
+
+	c.SetReadDeadline(time.Now().Add(splitPeekTimeout))
+	b, err := pc.r.Peek(1)
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	conns := sl.plain
+	if b[0] == tlsRecordHandshake {
+		conns = sl.tls
+	}
+
+	t := time.NewTimer(splitHandoffTimeout)
+	defer t.Stop()
+	select {
+	case conns <- pc:
+	case <-t.C:
+		c.Close()
+	case <-sl.done:
+		c.Close()
+	}
+}
+
+// subListener is one side of a split listener.
+type subListener struct {
+	sl    *splitListener
+	conns chan net.Conn
+}
+
+// Accept satisfies the net.Listener interface.
+func (sub *subListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-sub.conns:
+		return c, nil
+	case <-sub.sl.done:
+		return nil, sub.sl.err
+	}
+}
+
+// Close satisfies the net.Listener interface.
+func (sub *subListener) Close() error {
+	err := sub.sl.l.Close()
+	sub.sl.doneOnce.Do(func() {
+		sub.sl.err = errors.New("listener closed")
+		close(sub.sl.done)
+	})
+	return err
+}
+
+// Addr satisfies the net.Listener interface.
+func (sub *subListener) Addr() net.Addr {
+	return sub.sl.l.Addr()
+}
+
+// peekedConn is a connection whose first bytes have already been read into a
+// buffer.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads the peeked bytes before reading from the connection.
+func (pc *peekedConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	stdhttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestSplitTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	defer l.Close()
+
+	tlsL, plainL := http.SplitTLS(l)
+	serve := func(l net.Listener, body string) {
+		server := http.Server{
+			Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+				res.Write([]byte(body))
+			}),
+		}
+		server.Serve(l)
+	}
+	go serve(tls.NewListener(tlsL, &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}), "secure")
+	go serve(plainL, "plain")
+
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal("unable to split host and port:", err)
+	}
+	client := stdhttp.Client{
+		Transport: &stdhttp.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	for scheme, exp := range map[string]string{"https": "secure", "http": "plain"} {
+		resp, err := client.Get(scheme + "://localhost:" + port)
+		if err != nil {
+			t.Fatalf("%s: get failed: %v", scheme, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != exp {
+			t.Fatalf("%s: expected body '%s', got: '%s'", scheme, exp, body)
+		}
+	}
+}
+
+// testCertificate generates a self-signed certificate for localhost.
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("unable to generate key:", err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("unable to create certificate:", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point in time snapshot of a Server's activity.
+type Stats struct {
+	// OpenConns is the number of connections being served, of which
+	// ActiveConns are in the middle of a request and IdleConns are waiting for
+	// the next one.
+	OpenConns   int64
+	ActiveConns int64
+	IdleConns   int64
+
+	// TotalRequests is the number of requests read since the Server started.
+	TotalRequests int64
+	// BytesIn and BytesOut count the bytes read from and written to every
+	// connection.
+	BytesIn  int64
+	BytesOut int64
+	// Responses counts responses by status class, so Responses[2] is the
+	// number of 2xx responses and Responses[5] the number of 5xx responses.
+	Responses [6]int64
+
+	// Uptime is how long the Server has been serving for.
+	Uptime time.Duration
+}
+
+// serverStats holds the live counters behind Stats.
+type serverStats struct {
+	// started is when serving began, in Unix nanoseconds.
+	started atomic.Int64
+
+	openConns     atomic.Int64
+	activeConns   atomic.Int64
+	totalRequests atomic.Int64
+	bytesIn       atomic.Int64
+	bytesOut      atomic.Int64
+	responses     [6]atomic.Int64
+}
+
+// response counts a response with the given status.
+func (ss *serverStats) response(status int) {
+	if class := status / 100; class > 0 && class < len(ss.responses) {
+		ss.responses[class].Add(1)
+	}
+}
+
+// Stats returns a snapshot of the Server's activity. It can be called while
+// the Server is serving.
+func (s *Server) Stats() Stats {
+	st := Stats{
+		OpenConns:     s.stats.openConns.Load(),
+		ActiveConns:   s.stats.activeConns.Load(),
+		TotalRequests: s.stats.totalRequests.Load(),
+		BytesIn:       s.stats.bytesIn.Load(),
+		BytesOut:      s.stats.bytesOut.Load(),
+	}
+	st.IdleConns = st.OpenConns - st.ActiveConns
+	for i := range st.Responses {
+		st.Responses[i] = s.stats.responses[i].Load()
+	}
+	if started := s.stats.started.Load(); started != 0 {
+		st.Uptime = time.Since(time.Unix(0, started))
+	}
+
+	return st
+}
+
+// countingConn adds the bytes read from and written to a connection to a
+// Server's stats.
+type countingConn struct {
+	net.Conn
+	stats *serverStats
+}
+
+// Read satisfies the net.Conn interface.
+func (cc *countingConn) Read(b []byte) (int, error) {
+	n, err := cc.Conn.Read(b)
+	cc.stats.bytesIn.Add(int64(n))
+	return n, err
+}
+
+// Write satisfies the net.Conn interface.
+func (cc *countingConn) Write(b []byte) (int, error) {
+	n, err := cc.Conn.Write(b)
+	cc.stats.bytesOut.Add(int64(n))
+	return n, err
+}
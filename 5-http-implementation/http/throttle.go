@@ -0,0 +1,119 @@
+package http
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket that paces a stream of bytes to rate bytes per
+// second, allowing bursts of up to one second's worth.
+type bucket struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newBucket creates a full bucket for the given rate in bytes per second.
+func newBucket(rate int) *bucket {
+	return &bucket{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// burst is the most that can be taken from the bucket in one go.
+func (b *bucket) burst() int {
+	return int(b.rate)
+}
+
+// wait takes n tokens from the bucket, sleeping for as long as it takes for
+// them to become available.
+func (b *bucket) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+
+	// Go into debt and sleep it off rather than looping until the bucket has
+	// refilled.
+	b.tokens -= float64(n)
+	var d time.Duration
+	if b.tokens < 0 {
+		d = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// throttledConn limits the rate at which a connection can be read from or
+// written to. A nil bucket leaves that direction unthrottled.
+type throttledConn struct {
+	net.Conn
+	read, write *bucket
+}
+
+// throttle wraps c with the given read and write rates in bytes per second,
+// where zero means unlimited.
+func throttle(c net.Conn, readRate, writeRate int) net.Conn {
+	if readRate <= 0 && writeRate <= 0 {
+		return c
+	}
+
+	tc := &throttledConn{Conn: c}
+	if readRate > 0 {
+		tc.read = newBucket(readRate)
+	}
+	if writeRate > 0 {
+		tc.write = newBucket(writeRate)
+	}
+	return tc
+}
+
+// Read reads no more than a burst at a time and then waits until the bytes
+// that were read have been paid for.
+func (tc *throttledConn) Read(b []byte) (int, error) {
+	if tc.read == nil {
+		return tc.Conn.Read(b)
+	}
+
+	if max := tc.read.burst(); len(b) > max {
+		b = b[:max]
+	}
+	n, err := tc.Conn.Read(b)
+	tc.read.wait(n)
+	return n, err
+}
+
+// Write sends b a burst at a time, waiting for each burst to be allowed before
+// sending it.
+func (tc *throttledConn) Write(b []byte) (int, error) {
+	if tc.write == nil {
+		return tc.Conn.Write(b)
+	}
+
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if max := tc.write.burst(); len(chunk) > max {
+			chunk = chunk[:max]
+		}
+		tc.write.wait(len(chunk))
+
+		n, err := tc.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+
+	return written, nil
+}
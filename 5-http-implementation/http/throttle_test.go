@@ -0,0 +1,46 @@
+package http_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	stdhttp "net/http"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestWriteRate(t *testing.T) {
+	const (
+		rate = 20000
+		size = 30000
+	)
+
+	url := serveOn(t, &http.Server{
+		Handler: http.HandlerFunc(func(res *http.Response, req *http.Request) {
+			res.Write(bytes.Repeat([]byte("x"), size))
+		}),
+		WriteRate: rate,
+	})
+
+	start := time.Now()
+	resp, err := stdhttp.Get(url)
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal("unable to read body:", err)
+	}
+	elapsed := time.Since(start)
+
+	if len(body) != size {
+		t.Fatalf("expected %v bytes, got: %v", size, len(body))
+	}
+	// The first second's worth is sent as a burst, so the rest should take at
+	// least (size - rate) / rate seconds.
+	if min := time.Duration(float64(size-rate) / rate * float64(time.Second)); elapsed < min {
+		t.Fatalf("expected transfer to take at least %v, took: %v", min, elapsed)
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// ServeTLS is like Serve but terminates TLS on each accepted connection first.
+// certFile and keyFile hold a PEM encoded certificate, followed by any
+// intermediates, and its private key. They may be left empty if TLSConfig
+// already provides certificates.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// ListenAndServeTLS listens on addr (usually ":443") and serves HTTPS on it
+// with ServeTLS.
+func (s *Server) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
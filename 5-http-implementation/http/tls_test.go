@@ -0,0 +1,124 @@
+package http_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	stdhttp "net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+// describeURL is a handler that responds with the parts of the request URL.
+var describeURL = http.HandlerFunc(func(res *http.Response, req *http.Request) {
+	fmt.Fprintf(res, "%s %s %s q=%s tls=%v", req.URL.Scheme, req.URL.Host, req.URL.Path, req.Query.Get("q"), req.TLS != nil)
+})
+
+func TestServeTLS(t *testing.T) {
+	cert := testCertificate(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal("unable to marshal key:", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal("unable to write certificate:", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal("unable to write key:", err)
+	}
+
+	l, err := net.Listen("tcp", "")
+	if err != nil {
+		t.Fatal("unable to listen:", err)
+	}
+	server := &http.Server{Handler: describeURL}
+	t.Cleanup(func() { server.Close() })
+	go server.ServeTLS(l, certFile, keyFile)
+
+	client := &stdhttp.Client{
+		Transport: &stdhttp.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	resp, err := client.Get("https://localhost:" + port + "/search?q=tls")
+	if err != nil {
+		t.Fatal("get failed:", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if exp := "https localhost:" + port + " /search q=tls tls=true"; string(body) != exp {
+		t.Fatalf("expected '%s', got: '%s'", exp, body)
+	}
+}
+
+func TestRequestURL(t *testing.T) {
+	url := startServer(t, describeURL)
+	addr := strings.TrimPrefix(url, "http://")
+
+	cases := []struct {
+		name   string
+		req    string
+		status int
+		body   string
+	}{
+		{
+			name:   "origin form",
+			req:    "GET /a%20b?q=x+y HTTP/1.1\r\nHost: a.example\r\n\r\n",
+			status: 200,
+			body:   "http a.example /a b q=x y tls=false",
+		},
+		{
+			name:   "absolute form",
+			req:    "GET http://b.example/c HTTP/1.1\r\nHost: a.example\r\n\r\n",
+			status: 200,
+			body:   "http b.example /c q= tls=false",
+		},
+		{
+			name:   "malformed uri",
+			req:    "GET a/b HTTP/1.1\r\nHost: a.example\r\n\r\n",
+			status: 400,
+		},
+		{
+			name:   "malformed query",
+			req:    "GET /?q=%zz HTTP/1.1\r\nHost: a.example\r\n\r\n",
+			status: 400,
+		},
+	}
+
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal("unable to dial:", err)
+		}
+		if _, err := conn.Write([]byte(c.req)); err != nil {
+			t.Fatal("unable to write request:", err)
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: unable to read response: %v", c.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		conn.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("%s: expected status code %v, got: %v", c.name, c.status, resp.StatusCode)
+		}
+		if c.body != "" && string(body) != c.body {
+			t.Fatalf("%s: expected body '%s', got: '%s'", c.name, c.body, body)
+		}
+	}
+}
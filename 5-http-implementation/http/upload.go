@@ -0,0 +1,350 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// tusVersion is the version of the tus resumable upload protocol that
+// UploadHandler speaks.
+const tusVersion = "1.0.0"
+
+// ErrNoUpload is returned by an UploadStore for unknown upload IDs.
+var ErrNoUpload = errors.New("upload not found")
+
+// ErrUploadConflict is returned by UploadStore.Append when the upload is no
+// longer at the given offset, or is already being appended to.
+var ErrUploadConflict = errors.New("upload offset mismatch")
+
+// UploadInfo describes the progress of a resumable upload.
+type UploadInfo struct {
+	ID     string `json:"id"`
+	Length int64  `json:"length"`
+	Offset int64  `json:"offset"`
+}
+
+// UploadStore holds the data of resumable uploads. Implementations must be safe
+// for concurrent use.
+type UploadStore interface {
+	// Create starts a new upload of length bytes.
+	Create(length int64) (UploadInfo, error)
+	// Info returns the state of an upload, or ErrNoUpload.
+	Info(id string) (UploadInfo, error)
+	// Append writes data from r at the upload's current offset, which the
+	// caller has checked is offset. It returns the updated state, which
+	// reflects whatever was written even if err is set, or ErrUploadConflict
+	// if the offset has moved on in the meantime.
+	Append(id string, offset int64, r io.Reader) (UploadInfo, error)
+}
+
+// UploadHandler implements the core of the tus resumable upload protocol
+// along with its creation extension:
+//
+//   - POST Prefix with Upload-Length creates an upload and responds with its
+//     Location.
+//   - HEAD Prefix/{id} reports how much has been received in Upload-Offset.
+//   - PATCH Prefix/{id} appends a chunk sent at that Upload-Offset.
+//
+// Clients whose connection drops part way through a PATCH ask for the offset
+// with HEAD and carry on from there.
+type UploadHandler struct {
+	// Prefix is the path the handler is served under, e.g. "/files/".
+	Prefix string
+	Store  UploadStore
+
+	// MaxSize, if non-zero, is the largest upload that may be created.
+	MaxSize int64
+	// OnComplete, if set, is called once the last byte of an upload has been
+	// received. It is called once per upload, as further PATCHes to a
+	// finished upload are refused with 403.
+	OnComplete func(UploadInfo)
+}
+
+// ServeHTTP satisfies the Handler interface.
+func (uh *UploadHandler) ServeHTTP(res *Response, req *Request) {
+	res.Headers.Set("Tus-Resumable", tusVersion)
+
+	if req.Method == "OPTIONS" {
+		res.Status = 204
+		res.Headers.Set("Tus-Version", tusVersion)
+		res.Headers.Set("Tus-Extension", "creation")
+		if uh.MaxSize > 0 {
+			res.Headers.Set("Tus-Max-Size", strconv.FormatInt(uh.MaxSize, 10))
+		}
+		return
+	}
+
+	if req.Headers.Get("Tus-Resumable") != tusVersion {
+		res.Headers.Set("Tus-Version", tusVersion)
+		res.WriteError(412, "unsupported tus version")
+		return
+	}
+
+	path := req.URL.Path
+	base := strings.TrimSuffix(uh.Prefix, "/")
+	if path != base && !strings.HasPrefix(path, base+"/") {
+		res.WriteError(404, "")
+		return
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(path, base), "/")
+
+	switch {
+	case id == "" && req.Method == "POST":
+		uh.create(res, req)
+	case id != "" && req.Method == "HEAD":
+		uh.head(res, id)
+	case id != "" && req.Method == "PATCH":
+		uh.patch(res, req, id)
+	default:
+		res.WriteError(404, "")
+	}
+}
+
+// create starts a new upload.
+func (uh *UploadHandler) create(res *Response, req *Request) {
+	length, err := strconv.ParseInt(req.Headers.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		res.WriteError(400, "invalid upload-length")
+		return
+	}
+	if uh.MaxSize > 0 && length > uh.MaxSize {
+		res.WriteError(413, "upload is larger than the maximum size")
+		return
+	}
+
+	info, err := uh.Store.Create(length)
+	if err != nil {
+		res.WriteError(500, "unable to create upload")
+		return
+	}
+
+	res.Status = 201
+	res.Headers.Set("Location", strings.TrimSuffix(uh.Prefix, "/")+"/"+info.ID)
+
+	// An empty upload is complete as soon as it exists.
+	if length == 0 && uh.OnComplete != nil {
+		uh.OnComplete(info)
+	}
+}
+
+// head reports the progress of an upload.
+func (uh *UploadHandler) head(res *Response, id string) {
+	// Responses to HEAD must not have a body, so no detail is given.
+	info, err := uh.Store.Info(id)
+	if err == ErrNoUpload {
+		res.WriteError(404, "")
+		return
+	}
+	if err != nil {
+		res.WriteError(500, "")
+		return
+	}
+
+	res.Headers.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	res.Headers.Set("Upload-Length", strconv.FormatInt(info.Length, 10))
+	res.Headers.Set("Cache-Control", "no-store")
+}
+
+// patch appends a chunk to an upload.
+func (uh *UploadHandler) patch(res *Response, req *Request, id string) {
+	if req.Headers.Get("Content-Type") != "application/offset+octet-stream" {
+		res.WriteError(415, "content-type must be application/offset+octet-stream")
+		return
+	}
+	offset, err := strconv.ParseInt(req.Headers.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		res.WriteError(400, "invalid upload-offset")
+		return
+	}
+
+	info, err := uh.Store.Info(id)
+	if err == ErrNoUpload {
+		res.WriteError(404, "upload not found")
+		return
+	}
+	if err != nil {
+		res.WriteError(500, "unable to look up upload")
+		return
+	}
+	if info.Offset == info.Length {
+		res.WriteError(403, "upload is already complete")
+		return
+	}
+	if offset != info.Offset {
+		res.WriteError(409, "upload-offset does not match the upload")
+		return
+	}
+	prev := info.Offset
+
+	// Never accept more than was declared when the upload was created.
+	info, err = uh.Store.Append(id, offset, io.LimitReader(req.Body, info.Length-info.Offset))
+	if err == ErrUploadConflict {
+		res.WriteError(409, "upload-offset does not match the upload")
+		return
+	}
+	if err != nil {
+		res.WriteError(500, "unable to store chunk")
+		return
+	}
+
+	res.Status = 204
+	res.Headers.Set("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+
+	// Only the PATCH that finished the upload reports it complete.
+	if prev < info.Length && info.Offset == info.Length && uh.OnComplete != nil {
+		uh.OnComplete(info)
+	}
+}
+
+// FileUploadStore is an UploadStore that keeps each upload in Dir as a data
+// file plus a JSON file recording its progress.
+type FileUploadStore struct {
+	Dir string
+
+	// mu guards the progress files and appending, which holds the uploads
+	// being appended to. It is not held while data is copied so that a slow
+	// client only holds up its own upload.
+	mu        sync.Mutex
+	appending map[string]bool
+}
+
+// Create satisfies the UploadStore interface.
+func (f *FileUploadStore) Create(length int64) (UploadInfo, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return UploadInfo{}, err
+	}
+	info := UploadInfo{ID: hex.EncodeToString(b), Length: length}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := ioutil.WriteFile(f.dataPath(info.ID), nil, 0600); err != nil {
+		return UploadInfo{}, err
+	}
+	return info, f.writeInfo(info)
+}
+
+// Info satisfies the UploadStore interface.
+func (f *FileUploadStore) Info(id string) (UploadInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.readInfo(id)
+}
+
+// Append satisfies the UploadStore interface.
+func (f *FileUploadStore) Append(id string, offset int64, r io.Reader) (UploadInfo, error) {
+	f.mu.Lock()
+	info, err := f.readInfo(id)
+	if err == nil && (offset != info.Offset || f.appending[id]) {
+		err = ErrUploadConflict
+	}
+	if err != nil {
+		f.mu.Unlock()
+		return info, err
+	}
+	if f.appending == nil {
+		f.appending = make(map[string]bool)
+	}
+	f.appending[id] = true
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.appending, id)
+		f.mu.Unlock()
+	}()
+
+	file, err := os.OpenFile(f.dataPath(id), os.O_WRONLY, 0600)
+	if err != nil {
+		return info, err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return info, err
+	}
+
+	// Record whatever made it to disk, even if the client went away part way
+	// through, so that it can resume from there.
+	n, copyErr := io.Copy(file, r)
+	info.Offset += n
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writeInfo(info); err != nil {
+		return info, err
+	}
+	return info, copyErr
+}
+
+// Path returns the file holding the data of an upload, or "" if id is not
+// one that Create could have returned.
+func (f *FileUploadStore) Path(id string) string {
+	if !validUploadID(id) {
+		return ""
+	}
+	return f.dataPath(id)
+}
+
+// dataPath returns the file an upload's data is written to.
+func (f *FileUploadStore) dataPath(id string) string {
+	return filepath.Join(f.Dir, id+".bin")
+}
+
+// infoPath returns the file an upload's progress is recorded in.
+func (f *FileUploadStore) infoPath(id string) string {
+	return filepath.Join(f.Dir, id+".json")
+}
+
+// validUploadID reports whether id has the form Create gives IDs. Anything
+// else, such as an ID containing a path separator, cannot name an upload.
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	b, err := hex.DecodeString(id)
+	return err == nil && hex.EncodeToString(b) == id
+}
+
+// readInfo loads the progress of an upload.
+func (f *FileUploadStore) readInfo(id string) (UploadInfo, error) {
+	var info UploadInfo
+	if !validUploadID(id) {
+		return info, ErrNoUpload
+	}
+
+	btys, err := ioutil.ReadFile(f.infoPath(id))
+	if os.IsNotExist(err) {
+		return info, ErrNoUpload
+	}
+	if err != nil {
+		return info, err
+	}
+
+	err = json.Unmarshal(btys, &info)
+	return info, err
+}
+
+// writeInfo records the progress of an upload.
+func (f *FileUploadStore) writeInfo(info UploadInfo) error {
+	btys, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.infoPath(info.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, btys, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.infoPath(info.ID))
+}
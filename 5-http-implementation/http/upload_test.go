@@ -0,0 +1,146 @@
+package http_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestUploadHandler(t *testing.T) {
+	store := &http.FileUploadStore{Dir: t.TempDir()}
+	completed := make(chan http.UploadInfo, 1)
+	url := startServer(t, &http.UploadHandler{
+		Prefix: "/files/",
+		Store:  store,
+		OnComplete: func(info http.UploadInfo) {
+			completed <- info
+		},
+	})
+
+	do := func(method, path string, headers map[string]string, body string) *stdhttp.Response {
+		req, err := stdhttp.NewRequest(method, url+path, bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	patch := func(location string, offset int, chunk string) *stdhttp.Response {
+		return do("PATCH", location, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.Itoa(offset),
+		}, chunk)
+	}
+
+	resp := do("POST", "/files/", map[string]string{"Upload-Length": "10"}, "")
+	if resp.StatusCode != 201 {
+		t.Fatalf("expected status code 201, got: %v", resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+
+	if resp := patch(location, 0, "hello"); resp.StatusCode != 204 {
+		t.Fatalf("expected status code 204, got: %v", resp.StatusCode)
+	}
+
+	resp = do("HEAD", location, nil, "")
+	if exp := "5"; resp.Header.Get("Upload-Offset") != exp {
+		t.Fatalf("expected header 'Upload-Offset' = %v, got: %v", exp, resp.Header.Get("Upload-Offset"))
+	}
+
+	if resp := patch(location, 2, "llo"); resp.StatusCode != 409 {
+		t.Fatalf("expected mismatched offset to get 409, got: %v", resp.StatusCode)
+	}
+
+	if resp := patch(location, 5, "world"); resp.Header.Get("Upload-Offset") != "10" {
+		t.Fatalf("expected header 'Upload-Offset' = 10, got: %v", resp.Header.Get("Upload-Offset"))
+	}
+
+	info := <-completed
+	data, err := ioutil.ReadFile(store.Path(info.ID))
+	if err != nil {
+		t.Fatal("unable to read upload:", err)
+	}
+	if exp := "helloworld"; string(data) != exp {
+		t.Fatalf("expected upload '%s', got: '%s'", exp, data)
+	}
+
+	// Retrying the finishing PATCH must not complete the upload again.
+	for i := 0; i < 2; i++ {
+		if resp := patch(location, 10, ""); resp.StatusCode != 403 {
+			t.Fatalf("expected patch to a complete upload to get 403, got: %v", resp.StatusCode)
+		}
+	}
+	select {
+	case <-completed:
+		t.Fatal("expected OnComplete to be called once")
+	default:
+	}
+
+	// Only the IDs the store hands out name an upload.
+	if resp := do("HEAD", "/files/x/"+info.ID, nil, ""); resp.StatusCode != 404 {
+		t.Fatalf("expected path-like upload id to get 404, got: %v", resp.StatusCode)
+	}
+
+	if resp := do("HEAD", "/files/missing", nil, ""); resp.StatusCode != 404 {
+		t.Fatalf("expected unknown upload to get 404, got: %v", resp.StatusCode)
+	}
+}
+
+func TestFileUploadStoreSlowAppend(t *testing.T) {
+	store := &http.FileUploadStore{Dir: t.TempDir()}
+	slow, err := store.Create(10)
+	if err != nil {
+		t.Fatal("unable to create upload:", err)
+	}
+	other, err := store.Create(10)
+	if err != nil {
+		t.Fatal("unable to create upload:", err)
+	}
+
+	// Hold an append open on one upload.
+	pr, pw := io.Pipe()
+	appended := make(chan http.UploadInfo)
+	go func() {
+		info, _ := store.Append(slow.ID, 0, pr)
+		appended <- info
+	}()
+	pw.Write([]byte("abc"))
+
+	done := make(chan error)
+	go func() {
+		_, err := store.Info(other.ID)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("unable to get info:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected other uploads not to wait for a slow append")
+	}
+
+	if _, err := store.Append(slow.ID, 0, strings.NewReader("x")); err != http.ErrUploadConflict {
+		t.Fatalf("expected concurrent append to give %v, got: %v", http.ErrUploadConflict, err)
+	}
+
+	pw.Close()
+	if info := <-appended; info.Offset != 3 {
+		t.Fatalf("expected offset 3, got: %v", info.Offset)
+	}
+}
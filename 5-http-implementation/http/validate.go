@@ -0,0 +1,257 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Rule describes what is acceptable for a single query parameter, header or
+// JSON body field.
+type Rule struct {
+	// Required fails requests that leave the value out.
+	Required bool
+	// Type is one of "string", "int", "number" or "bool". An empty Type
+	// accepts any value.
+	Type string
+	// Range bounds numbers, or the length of strings.
+	Range *Range
+	// Pattern must match string values.
+	Pattern *regexp.Regexp
+}
+
+// Range is an inclusive interval.
+type Range struct {
+	Min, Max float64
+}
+
+// Schema declares the rules that a request must satisfy. Header names are
+// case insensitive. Body rules apply to the top-level
+// fields of a JSON object body.
+type Schema struct {
+	Query   map[string]Rule
+	Headers map[string]Rule
+	Body    map[string]Rule
+
+	// MaxBodyBytes caps how much of the body is read to check it against the
+	// Body rules. Larger bodies are rejected with 413. If zero,
+	// DefaultMaxBodyBytes is used.
+	MaxBodyBytes int64
+}
+
+// Violation is a single way in which a request failed its Schema.
+type Violation struct {
+	In      string `json:"in"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// Validate wraps a Handler so that requests are checked against schema before
+// being handled. Requests that fail are answered with a 400 and a JSON object
+// listing the Violations instead, or a problem details document with the
+// Violations under "errors" when ProblemJSON is enabled.
+func Validate(h Handler, schema Schema) Handler {
+	return HandlerFunc(func(res *Response, req *Request) {
+		violations, err := schema.check(req)
+		if err == errBodyTooLarge {
+			res.WriteError(413, "request body is too large to validate")
+			return
+		}
+		if len(violations) == 0 {
+			h.ServeHTTP(res, req)
+			return
+		}
+
+		if res.problem {
+			res.writeProblem(400, "request failed validation", map[string]interface{}{
+				"errors": violations,
+			})
+			return
+		}
+
+		btys, _ := json.Marshal(struct {
+			Errors []Violation `json:"errors"`
+		}{violations})
+		res.Status = 400
+		res.Headers.Set("Content-Type", "application/json")
+		res.Write(btys)
+	})
+}
+
+// check returns every rule that req violates. If the body is checked it is
+// read in full and replaced so that the handler can still read it; err is
+// only set if the body is too large to check.
+func (s Schema) check(req *Request) (vs []Violation, err error) {
+	if len(s.Query) > 0 {
+		query := req.Query
+		vs = append(vs, checkStrings("query", s.Query, func(name string) (string, bool) {
+			v, ok := query[name]
+			if !ok {
+				return "", false
+			}
+			return v[0], true
+		})...)
+	}
+
+	if len(s.Headers) > 0 {
+		vs = append(vs, checkStrings("header", s.Headers, func(name string) (string, bool) {
+			v := req.Headers.Values(name)
+			if v == nil {
+				return "", false
+			}
+			return v[0], true
+		})...)
+	}
+
+	if len(s.Body) > 0 {
+		btys, err := readBody(req.Body, s.MaxBodyBytes)
+		if err == errBodyTooLarge {
+			return nil, err
+		}
+		if err != nil {
+			return append(vs, Violation{In: "body", Message: "unable to read body"}), nil
+		}
+		req.Body = bytes.NewReader(btys)
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal(btys, &fields); err != nil {
+			return append(vs, Violation{In: "body", Message: "must be a JSON object"}), nil
+		}
+
+		for _, name := range sortedRules(s.Body) {
+			r := s.Body[name]
+			v, ok := fields[name]
+			if msg := r.checkJSON(v, ok); msg != "" {
+				vs = append(vs, Violation{In: "body", Name: name, Message: msg})
+			}
+		}
+	}
+
+	return vs, nil
+}
+
+// checkStrings validates values that arrive as text, such as query parameters
+// and headers.
+func checkStrings(in string, rules map[string]Rule, lookup func(string) (string, bool)) []Violation {
+	var vs []Violation
+
+	for _, name := range sortedRules(rules) {
+		v, ok := lookup(name)
+		if msg := rules[name].checkString(v, ok); msg != "" {
+			vs = append(vs, Violation{In: in, Name: name, Message: msg})
+		}
+	}
+
+	return vs
+}
+
+// sortedRules returns rule names in order so that violations are reported
+// consistently.
+func sortedRules(rules map[string]Rule) []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkString validates a textual value, converting it to the rule's Type
+// first. It returns a description of the problem, or "" if there is none.
+func (r Rule) checkString(v string, present bool) string {
+	if !present {
+		if r.Required {
+			return "is required"
+		}
+		return ""
+	}
+
+	switch r.Type {
+	case "int":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "must be an int"
+		}
+		return r.checkNumber(float64(n))
+	case "number":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "must be a number"
+		}
+		return r.checkNumber(n)
+	case "bool":
+		if _, err := strconv.ParseBool(v); err != nil {
+			return "must be a bool"
+		}
+		return ""
+	}
+
+	return r.checkText(v)
+}
+
+// checkJSON validates a decoded JSON value. It returns a description of the
+// problem, or "" if there is none.
+func (r Rule) checkJSON(v interface{}, present bool) string {
+	if !present || v == nil {
+		if r.Required {
+			return "is required"
+		}
+		return ""
+	}
+
+	switch r.Type {
+	case "int":
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			return "must be an int"
+		}
+		return r.checkNumber(n)
+	case "number":
+		n, ok := v.(float64)
+		if !ok {
+			return "must be a number"
+		}
+		return r.checkNumber(n)
+	case "bool":
+		if _, ok := v.(bool); !ok {
+			return "must be a bool"
+		}
+		return ""
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return "must be a string"
+		}
+		return r.checkText(s)
+	}
+
+	if s, ok := v.(string); ok {
+		return r.checkText(s)
+	}
+	return ""
+}
+
+// checkNumber applies the rule's Range to a number.
+func (r Rule) checkNumber(n float64) string {
+	if r.Range != nil && (n < r.Range.Min || n > r.Range.Max) {
+		return fmt.Sprintf("must be between %v and %v", r.Range.Min, r.Range.Max)
+	}
+	return ""
+}
+
+// checkText applies the rule's Range and Pattern to a string.
+func (r Rule) checkText(s string) string {
+	if r.Range != nil {
+		if l := float64(len(s)); l < r.Range.Min || l > r.Range.Max {
+			return fmt.Sprintf("length must be between %v and %v", r.Range.Min, r.Range.Max)
+		}
+	}
+	if r.Pattern != nil && !r.Pattern.MatchString(s) {
+		return fmt.Sprintf("must match %s", r.Pattern)
+	}
+	return ""
+}
@@ -0,0 +1,91 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	stdhttp "net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nstogner/learning-http/5-http-implementation/http"
+)
+
+func TestValidate(t *testing.T) {
+	schema := http.Schema{
+		Query: map[string]http.Rule{
+			"limit": {Type: "int", Range: &http.Range{Min: 1, Max: 100}},
+		},
+		Headers: map[string]http.Rule{
+			"x-request-id": {Required: true, Pattern: regexp.MustCompile(`^[a-f0-9]+$`)},
+		},
+		Body: map[string]http.Rule{
+			"name": {Required: true, Type: "string"},
+			"age":  {Type: "int", Range: &http.Range{Min: 0, Max: 150}},
+		},
+		MaxBodyBytes: 64,
+	}
+
+	var handled []byte
+	url := startServer(t, http.Validate(http.HandlerFunc(func(res *http.Response, req *http.Request) {
+		handled = make([]byte, 64)
+		n, _ := req.Body.Read(handled)
+		handled = handled[:n]
+	}), schema))
+
+	post := func(path, id, body string) *stdhttp.Response {
+		req, err := stdhttp.NewRequest("POST", url+path, bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal("unable to create request:", err)
+		}
+		req.Header.Set("X-Request-Id", id)
+		resp, err := stdhttp.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("post failed:", err)
+		}
+		return resp
+	}
+
+	const valid = `{"name":"gopher","age":11}`
+	resp := post("/?limit=10", "abc123", valid)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got: %v", resp.StatusCode)
+	}
+	if string(handled) != valid {
+		t.Fatalf("expected handler to read body '%s', got: '%s'", valid, handled)
+	}
+
+	resp = post("/?limit=10", "abc123", `{"name":"`+strings.Repeat("x", 64)+`"}`)
+	resp.Body.Close()
+	if resp.StatusCode != 413 {
+		t.Fatalf("expected oversized body to get 413, got: %v", resp.StatusCode)
+	}
+
+	resp = post("/?limit=1000", "XYZ", `{"age":1.5}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected status code 400, got: %v", resp.StatusCode)
+	}
+	var result struct {
+		Errors []http.Violation `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal("unable to decode violations:", err)
+	}
+
+	exp := []http.Violation{
+		{In: "query", Name: "limit", Message: "must be between 1 and 100"},
+		{In: "header", Name: "x-request-id", Message: "must match ^[a-f0-9]+$"},
+		{In: "body", Name: "age", Message: "must be an int"},
+		{In: "body", Name: "name", Message: "is required"},
+	}
+	if len(result.Errors) != len(exp) {
+		t.Fatalf("expected %v violations, got: %v", len(exp), result.Errors)
+	}
+	for i := range exp {
+		if result.Errors[i] != exp[i] {
+			t.Fatalf("expected violation %v, got: %v", exp[i], result.Errors[i])
+		}
+	}
+}